@@ -2,11 +2,13 @@ package filesystem
 
 import (
 	"chat-app/backend/repository"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -44,3 +46,31 @@ func (l *localStorage) Save(file multipart.File, header *multipart.FileHeader) (
 	return fileURL, nil
 }
 
+func (l *localStorage) Open(fileURL string) (io.ReadCloser, error) {
+	path, err := l.pathFor(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l *localStorage) Delete(fileURL string) error {
+	path, err := l.pathFor(fileURL)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// pathFor maps a URL handed out by Save back to its file, refusing anything
+// outside the storage directory.
+func (l *localStorage) pathFor(fileURL string) (string, error) {
+	name := filepath.Base(fileURL)
+	if filepath.Join(l.routePath, name) != filepath.Clean(fileURL) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("file %q is not in local storage", fileURL)
+	}
+	return filepath.Join(l.storageDir, name), nil
+}
@@ -1,11 +1,20 @@
 package http
 
 import (
+	"chat-app/backend/adapter/middleware"
 	"chat-app/backend/adapter/util"
 	"chat-app/backend/models"
 	"encoding/json"
 	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type loginRequest struct {
@@ -15,7 +24,12 @@ type loginRequest struct {
 
 type loginResponse struct {
 	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -25,68 +39,255 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.authUsecase.Login(r.Context(), req.Username, req.Password)
+	result, err := h.authUsecase.Login(r.Context(), req.Username, req.Password, util.ClientIP(r))
 	if err != nil {
+		if respondIfLockedOut(w, err) {
+			return
+		}
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to login")
+		util.RespondWithInternalError(w, r, err, "Failed to login")
+		return
+	}
+
+	if result.ChallengeToken != "" {
+		util.RespondWithJSON(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+		})
+		return
+	}
+
+	h.respondWithTokens(w, result.AccessToken, result.RefreshToken)
+}
+
+// respondIfLockedOut answers 429 with Retry-After when err is a lockout.
+func respondIfLockedOut(w http.ResponseWriter, err error) bool {
+	var lockoutErr *models.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockoutErr.RetryAfter.Seconds()))))
+	util.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+	return true
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	result, err := h.authUsecase.CompleteTwoFactorLogin(r.Context(), req.ChallengeToken, req.Code, util.ClientIP(r))
+	if err != nil {
+		if respondIfLockedOut(w, err) {
+			return
+		}
+		if errors.Is(err, models.ErrChallengeNotFound) || errors.Is(err, models.ErrInvalidTwoFactorCode) {
+			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Failed to login")
 		return
 	}
 
+	h.respondWithTokens(w, result.AccessToken, result.RefreshToken)
+}
+
+// respondWithTokens returns a token pair, moving the refresh token into an
+// HttpOnly cookie when cookie delivery is enabled.
+func (h *AuthHandler) respondWithTokens(w http.ResponseWriter, accessToken, refreshToken string) {
+	if h.cookieOpts.RefreshTokenCookie {
+		h.cookieOpts.setRefreshCookies(w, refreshToken)
+		refreshToken = ""
+	}
+
 	util.RespondWithJSON(w, http.StatusOK, loginResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	})
 }
 
-type refreshRequest struct {
-	RefreshToken string `json:"refreshToken"`
+// decodeOptionalJSON decodes the request body into v, tolerating an empty
+// body for clients that send their refresh token as a cookie.
+func decodeOptionalJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
 }
 
-type refreshResponse struct {
-	AccessToken string `json:"accessToken"`
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	var req refreshRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeOptionalJSON(r, &req); err != nil {
 		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = refreshTokenFromCookie(r)
+	}
 
-	newAccessToken, err := h.authUsecase.Refresh(r.Context(), req.RefreshToken)
+	newAccessToken, newRefreshToken, err := h.authUsecase.Refresh(r.Context(), req.RefreshToken)
 	if err != nil {
-		if errors.Is(err, models.ErrSessionNotFound) || errors.Is(err, models.ErrInvalidToken) {
+		if errors.Is(err, models.ErrSessionNotFound) || errors.Is(err, models.ErrInvalidToken) || errors.Is(err, models.ErrRefreshTokenReused) {
+			if h.cookieOpts.RefreshTokenCookie {
+				h.cookieOpts.clearRefreshCookies(w)
+			}
 			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to refresh token")
+		util.RespondWithInternalError(w, r, err, "Failed to refresh token")
 		return
 	}
 
-	util.RespondWithJSON(w, http.StatusOK, refreshResponse{AccessToken: newAccessToken})
+	h.respondWithTokens(w, newAccessToken, newRefreshToken)
 }
 
 type logoutRequest struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// Logout revokes the session. It is also mounted as DELETE /api/v1/refresh,
+// the only path the refresh token cookie is sent to.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req logoutRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeOptionalJSON(r, &req); err != nil {
 		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = refreshTokenFromCookie(r)
+	}
+
+	// Clear the cookie whatever happens next, so the browser never keeps a
+	// refresh token the user asked to discard.
+	if h.cookieOpts.RefreshTokenCookie {
+		h.cookieOpts.clearRefreshCookies(w)
+	}
+
+	// The access token is optional; when present it is revoked as well.
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 
-	if err := h.authUsecase.Logout(r.Context(), req.RefreshToken); err != nil {
+	if err := h.authUsecase.Logout(r.Context(), req.RefreshToken, accessToken); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		// We can choose to not return an error to the client for logout failures
 		// for security reasons, but for simplicity we will.
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to logout")
+		util.RespondWithInternalError(w, r, err, "Failed to logout")
 		return
 	}
 
 	util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
 }
 
+type wsTicketResponse struct {
+	Ticket string `json:"ticket"`
+}
+
+func (h *AuthHandler) IssueWsTicket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	tokenExpiresAt, ok := r.Context().Value(middleware.TokenExpiresAtKey).(time.Time)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid token expiry")
+		return
+	}
+
+	ticket, err := h.authUsecase.IssueWsTicket(r.Context(), userID, tokenExpiresAt)
+	if err != nil {
+		util.RespondWithInternalError(w, r, err, "Failed to issue WebSocket ticket")
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusCreated, wsTicketResponse{Ticket: ticket})
+}
+
+// JWKS publishes the public keys used to verify access tokens.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	util.RespondWithJSON(w, http.StatusOK, h.authUsecase.JWKS())
+}
+
+// UnlockAccount lets an admin lift a login lockout.
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	if err := h.authUsecase.UnlockAccount(r.Context(), adminID, username); err != nil {
+		switch {
+		case errors.Is(err, models.ErrForbidden):
+			util.RespondWithError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not unlock account")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Account unlocked"})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangePassword signs out every other session and answers with a new access
+// token, since the one used for this request has been revoked with the rest.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(uuid.UUID)
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Current and new password are required")
+		return
+	}
+
+	accessToken, err := h.authUsecase.ChangePassword(r.Context(), userID, sessionID, req.CurrentPassword, req.NewPassword, util.ClientIP(r))
+	if err != nil {
+		if respondIfLockedOut(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			// Not 401: the caller's token is fine, the confirmation is not.
+			util.RespondWithError(w, http.StatusForbidden, "Current password is incorrect")
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, models.ErrWeakPassword):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not change password")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string]string{"accessToken": accessToken})
+}
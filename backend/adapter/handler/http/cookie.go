@@ -0,0 +1,75 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"chat-app/backend/adapter/middleware"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RefreshTokenCookieName = "refresh_token"
+	refreshTokenCookiePath = "/api/v1/refresh"
+)
+
+// CookieOptions controls delivery of the refresh token as an HttpOnly cookie
+// instead of in the JSON body, which keeps it out of reach of page scripts.
+type CookieOptions struct {
+	RefreshTokenCookie bool
+	Secure             bool
+	MaxAge             time.Duration
+}
+
+// setRefreshCookies sets the refresh token cookie together with a fresh CSRF
+// token. The CSRF cookie is readable by scripts so the app can echo it in the
+// X-CSRF-Token header.
+func (o CookieOptions) setRefreshCookies(w http.ResponseWriter, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    refreshToken,
+		Path:     refreshTokenCookiePath,
+		MaxAge:   int(o.MaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   o.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    uuid.New().String(),
+		Path:     "/",
+		MaxAge:   int(o.MaxAge.Seconds()),
+		Secure:   o.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (o CookieOptions) clearRefreshCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    "",
+		Path:     refreshTokenCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   o.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// refreshTokenFromCookie returns the refresh token cookie value, if any.
+func refreshTokenFromCookie(r *http.Request) string {
+	cookie, err := r.Cookie(RefreshTokenCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"chat-app/backend/adapter/middleware"
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func (h *EmailHandler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.emailUsecase.SetEmail(r.Context(), userID, req.Email); err != nil {
+		switch {
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, models.ErrInvalidEmail):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not update email")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusAccepted, map[string]string{"message": "Verification email sent"})
+}
+
+func (h *EmailHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.emailUsecase.VerifyEmail(r.Context(), req.Token); err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailTokenInvalid), errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusBadRequest, models.ErrEmailTokenInvalid.Error())
+		case errors.Is(err, models.ErrEmailTaken):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not verify email")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+func (h *EmailHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.emailUsecase.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		if errors.Is(err, models.ErrInvalidEmail) {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Could not request password reset")
+		return
+	}
+
+	// Same answer whether or not the address is known.
+	util.RespondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If that address belongs to a verified account, a reset link has been sent",
+	})
+}
+
+func (h *EmailHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.emailUsecase.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailTokenInvalid), errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusBadRequest, models.ErrEmailTokenInvalid.Error())
+		case errors.Is(err, models.ErrWeakPassword):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not reset password")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
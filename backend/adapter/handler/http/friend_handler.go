@@ -33,10 +33,10 @@ func (h *FriendHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, models.ErrUserNotFound):
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
-		case errors.Is(err, models.ErrAlreadyFriends), errors.Is(err, models.ErrFriendRequestExists), errors.Is(err, models.ErrCannotFriendSelf):
+		case errors.Is(err, models.ErrAlreadyFriends), errors.Is(err, models.ErrFriendRequestExists), errors.Is(err, models.ErrCannotFriendSelf), errors.Is(err, models.ErrUserBlocked):
 			util.RespondWithError(w, http.StatusConflict, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not send friend request")
+			util.RespondWithInternalError(w, r, err, "Could not send friend request")
 		}
 		return
 	}
@@ -84,7 +84,7 @@ func (h *FriendHandler) RespondToRequest(w http.ResponseWriter, r *http.Request)
 		case errors.Is(usecaseErr, models.ErrFriendRequestNotFound):
 			util.RespondWithError(w, http.StatusNotFound, usecaseErr.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not respond to friend request")
+			util.RespondWithInternalError(w, r, usecaseErr, "Could not respond to friend request")
 		}
 		return
 	}
@@ -112,7 +112,7 @@ func (h *FriendHandler) Unfriend(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, models.ErrNotFriends), errors.Is(err, models.ErrFriendRequestNotFound):
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not unfriend user")
+			util.RespondWithInternalError(w, r, err, "Could not unfriend user")
 		}
 		return
 	}
@@ -129,7 +129,7 @@ func (h *FriendHandler) ListFriends(w http.ResponseWriter, r *http.Request) {
 
 	friends, err := h.friendUsecase.ListFriends(r.Context(), userID)
 	if err != nil {
-		util.RespondWithError(w, http.StatusInternalServerError, "Could not list friends")
+		util.RespondWithInternalError(w, r, err, "Could not list friends")
 		return
 	}
 
@@ -145,9 +145,96 @@ func (h *FriendHandler) ListPendingRequests(w http.ResponseWriter, r *http.Reque
 
 	requests, err := h.friendUsecase.ListPendingRequests(r.Context(), userID)
 	if err != nil {
-		util.RespondWithError(w, http.StatusInternalServerError, "Could not list pending requests")
+		util.RespondWithInternalError(w, r, err, "Could not list pending requests")
 		return
 	}
 
 	util.RespondWithJSON(w, http.StatusOK, requests)
 }
+
+func (h *FriendHandler) SuggestFriends(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	suggestions, err := h.friendUsecase.SuggestFriends(r.Context(), userID)
+	if err != nil {
+		util.RespondWithInternalError(w, r, err, "Could not list friend suggestions")
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, suggestions)
+}
+
+func (h *FriendHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.friendUsecase.BlockUser(r.Context(), userID, req.Username); err != nil {
+		switch {
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, models.ErrCannotBlockSelf):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not block user")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FriendHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	blockedID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.friendUsecase.UnblockUser(r.Context(), userID, blockedID); err != nil {
+		if errors.Is(err, models.ErrBlockNotFound) {
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Could not unblock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FriendHandler) ListBlocked(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	users, err := h.friendUsecase.ListBlocked(r.Context(), userID)
+	if err != nil {
+		util.RespondWithInternalError(w, r, err, "Could not list blocked users")
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, users)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"chat-app/backend/adapter/middleware"
 	"chat-app/backend/adapter/util"
@@ -29,6 +30,7 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	handle := r.FormValue("handle")
 	name := r.FormValue("name")
+	isPrivate := r.FormValue("isPrivate") == "true"
 	if handle == "" || name == "" {
 		util.RespondWithError(w, http.StatusBadRequest, "Handle and name are required")
 		return
@@ -43,13 +45,13 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 	}
 
-	group, err := h.groupUsecase.CreateGroup(r.Context(), userID, handle, name, file, header)
+	group, err := h.groupUsecase.CreateGroup(r.Context(), userID, handle, name, isPrivate, file, header)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrGroupHandleTaken):
 			util.RespondWithError(w, http.StatusConflict, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not create group")
+			util.RespondWithInternalError(w, r, err, "Could not create group")
 		}
 		return
 	}
@@ -80,7 +82,7 @@ func (h *GroupHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, models.ErrAlreadyGroupMember):
 			util.RespondWithError(w, http.StatusConflict, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not join group")
+			util.RespondWithInternalError(w, r, err, "Could not join group")
 		}
 		return
 	}
@@ -108,7 +110,7 @@ func (h *GroupHandler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, models.ErrGroupNotFound), errors.Is(err, models.ErrNotGroupMember):
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not leave group")
+			util.RespondWithInternalError(w, r, err, "Could not leave group")
 		}
 		return
 	}
@@ -146,7 +148,7 @@ func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, models.ErrAlreadyGroupMember):
 			util.RespondWithError(w, http.StatusConflict, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not add member")
+			util.RespondWithInternalError(w, r, err, "Could not add member")
 		}
 		return
 	}
@@ -183,7 +185,7 @@ func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, models.ErrGroupNotFound), errors.Is(err, models.ErrNotGroupMember):
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
 		default:
-			util.RespondWithError(w, http.StatusInternalServerError, "Could not remove member")
+			util.RespondWithInternalError(w, r, err, "Could not remove member")
 		}
 		return
 	}
@@ -191,6 +193,86 @@ func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *GroupHandler) SetSlowMode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	groupIDStr := chi.URLParam(r, "groupID")
+	groupID, err := uuid.Parse(groupIDStr)
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	var req struct {
+		Seconds int `json:"seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	group, err := h.groupUsecase.SetSlowMode(r.Context(), userID, groupID, req.Seconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrBadRequest):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrNotGroupOwner):
+			util.RespondWithError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrGroupNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not update slow mode")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, group)
+}
+
+func (h *GroupHandler) SetPrivate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	groupIDStr := chi.URLParam(r, "groupID")
+	groupID, err := uuid.Parse(groupIDStr)
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+
+	var req struct {
+		IsPrivate bool `json:"isPrivate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	group, err := h.groupUsecase.SetPrivate(r.Context(), userID, groupID, req.IsPrivate)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotGroupOwner):
+			util.RespondWithError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrGroupNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not update group privacy")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, group)
+}
+
+const defaultGroupSearchLimit = 20
+
 func (h *GroupHandler) SearchGroups(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
@@ -198,9 +280,27 @@ func (h *GroupHandler) SearchGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groups, err := h.groupUsecase.SearchGroups(r.Context(), query)
+	limit, offset := defaultGroupSearchLimit, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	groups, err := h.groupUsecase.SearchGroups(r.Context(), query, limit, offset)
 	if err != nil {
-		util.RespondWithError(w, http.StatusInternalServerError, "Could not search for groups")
+		util.RespondWithInternalError(w, r, err, "Could not search for groups")
 		return
 	}
 
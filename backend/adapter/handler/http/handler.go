@@ -1,15 +1,17 @@
 package http
 
 import (
+	"chat-app/backend/adapter/health"
 	"chat-app/backend/usecase"
 )
 
 type AuthHandler struct {
 	authUsecase usecase.AuthUsecase
+	cookieOpts  CookieOptions
 }
 
-func NewAuthHandler(authUsecase usecase.AuthUsecase) *AuthHandler {
-	return &AuthHandler{authUsecase: authUsecase}
+func NewAuthHandler(authUsecase usecase.AuthUsecase, cookieOpts CookieOptions) *AuthHandler {
+	return &AuthHandler{authUsecase: authUsecase, cookieOpts: cookieOpts}
 }
 
 type UserHandler struct {
@@ -35,3 +37,36 @@ type GroupHandler struct {
 func NewGroupHandler(groupUsecase usecase.GroupUsecase) *GroupHandler {
 	return &GroupHandler{groupUsecase: groupUsecase}
 }
+
+type TwoFactorHandler struct {
+	twoFactorUsecase usecase.TwoFactorUsecase
+	authUsecase      usecase.AuthUsecase
+}
+
+func NewTwoFactorHandler(twoFactorUsecase usecase.TwoFactorUsecase, authUsecase usecase.AuthUsecase) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactorUsecase: twoFactorUsecase, authUsecase: authUsecase}
+}
+
+type EmailHandler struct {
+	emailUsecase usecase.EmailUsecase
+}
+
+func NewEmailHandler(emailUsecase usecase.EmailUsecase) *EmailHandler {
+	return &EmailHandler{emailUsecase: emailUsecase}
+}
+
+type SearchHandler struct {
+	searchUsecase usecase.SearchUsecase
+}
+
+func NewSearchHandler(searchUsecase usecase.SearchUsecase) *SearchHandler {
+	return &SearchHandler{searchUsecase: searchUsecase}
+}
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"net/http"
+
+	"chat-app/backend/adapter/health"
+	"chat-app/backend/adapter/util"
+)
+
+// Livez handles GET /livez. It only shows that the process is serving HTTP;
+// dependencies are left to Readyz so that an outage elsewhere does not get
+// the server restarted.
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Readyz handles GET /readyz, reporting each component. It answers 503
+// while any check fails or the server is shutting down.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Check(r.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	util.RespondWithJSON(w, code, report)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-app/backend/adapter/middleware"
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+
+	"github.com/google/uuid"
+)
+
+// SearchMessages handles GET /api/v1/search/messages. Besides q it accepts the
+// optional filters sender, conversation, from and to (RFC 3339), plus limit
+// and cursor for paging.
+func (h *SearchHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	params := r.URL.Query()
+	query := models.MessageSearchQuery{Text: params.Get("q")}
+	if query.Text == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Query parameter 'q' is required")
+		return
+	}
+
+	var err error
+	if query.SenderID, err = optionalUUIDParam(params.Get("sender")); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid sender ID")
+		return
+	}
+	if query.ConversationID, err = optionalUUIDParam(params.Get("conversation")); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return
+	}
+	if query.From, err = optionalTimeParam(params.Get("from")); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid 'from' date, expected RFC 3339")
+		return
+	}
+	if query.To, err = optionalTimeParam(params.Get("to")); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid 'to' date, expected RFC 3339")
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	page, err := h.searchUsecase.SearchMessages(r.Context(), userID, query, params.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, models.ErrBadRequest) {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Could not search messages")
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, page)
+}
+
+func optionalUUIDParam(v string) (*uuid.UUID, error) {
+	if v == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func optionalTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
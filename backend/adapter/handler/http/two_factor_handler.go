@@ -0,0 +1,100 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"chat-app/backend/adapter/middleware"
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func (h *TwoFactorHandler) BeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	enrollment, err := h.twoFactorUsecase.BeginEnrollment(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTwoFactorAlreadyEnabled):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not start two-factor enrollment")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, enrollment)
+}
+
+func (h *TwoFactorHandler) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorUsecase.ConfirmEnrollment(r.Context(), userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidTwoFactorCode):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrTwoFactorAlreadyEnabled), errors.Is(err, models.ErrTwoFactorNotEnabled):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not confirm two-factor enrollment")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string][]string{"recoveryCodes": recoveryCodes})
+}
+
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err := h.authUsecase.DisableTwoFactor(r.Context(), userID, req.Password, req.Code, util.ClientIP(r))
+	if err != nil {
+		if respondIfLockedOut(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials), errors.Is(err, models.ErrInvalidTwoFactorCode):
+			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, models.ErrTwoFactorNotEnabled):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Could not disable two-factor authentication")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
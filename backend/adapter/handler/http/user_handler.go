@@ -1,12 +1,16 @@
 package http
 
 import (
+	"bytes"
 	"chat-app/backend/adapter/middleware"
 	"chat-app/backend/adapter/util"
 	"chat-app/backend/models"
+	"chat-app/backend/usecase"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -26,17 +30,39 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userUsecase.Register(r.Context(), req.Username, req.Password)
 	if err != nil {
-		if errors.Is(err, models.ErrUsernameTaken) || err.Error() == "invalid username format" || err.Error() == "password is too short" {
+		if errors.Is(err, models.ErrUsernameTaken) || errors.Is(err, models.ErrWeakPassword) || errors.Is(err, models.ErrInvalidProfile) {
 			util.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to register user")
+		util.RespondWithInternalError(w, r, err, "Failed to register user")
 		return
 	}
 
 	util.RespondWithJSON(w, http.StatusCreated, user)
 }
 
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Query parameter 'q' is required")
+		return
+	}
+
+	users, err := h.userUsecase.SearchUsers(r.Context(), viewerID, query)
+	if err != nil {
+		util.RespondWithInternalError(w, r, err, "Could not search for users")
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, users)
+}
+
 func (h *UserHandler) GetUserByUsername(w http.ResponseWriter, r *http.Request) {
 	username := chi.URLParam(r, "username")
 	if username == "" {
@@ -44,13 +70,15 @@ func (h *UserHandler) GetUserByUsername(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := h.userUsecase.GetByUsername(r.Context(), username)
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+
+	user, err := h.userUsecase.GetByUsername(r.Context(), viewerID, username)
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
 			return
 		}
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to get user")
+		util.RespondWithInternalError(w, r, err, "Failed to get user")
 		return
 	}
 
@@ -69,12 +97,23 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var username, password *string
+	// Passwords are changed through POST /api/v1/me/password, which checks
+	// the current one.
+	if r.FormValue("password") != "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Use /api/v1/me/password to change the password")
+		return
+	}
+
+	var update usecase.ProfileUpdate
 	if val := r.FormValue("username"); val != "" {
-		username = &val
+		update.Username = &val
 	}
-	if val := r.FormValue("password"); val != "" {
-		password = &val
+	// Display name and bio may be cleared, so a present but empty field counts.
+	update.DisplayName = optionalFormValue(r, "displayName")
+	update.Bio = optionalFormValue(r, "bio")
+	if val := r.FormValue("lastSeenVisibility"); val != "" {
+		visibility := models.LastSeenVisibility(val)
+		update.LastSeenVisibility = &visibility
 	}
 
 	file, header, err := r.FormFile("profilePic")
@@ -86,7 +125,7 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 	}
 
-	user, err := h.userUsecase.UpdateProfile(r.Context(), userID, username, password, file, header)
+	user, err := h.userUsecase.UpdateProfile(r.Context(), userID, update, file, header)
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
 			util.RespondWithError(w, http.StatusNotFound, err.Error())
@@ -96,15 +135,135 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 			util.RespondWithError(w, http.StatusConflict, err.Error())
 			return
 		}
-		// Check for validation errors
-		if err.Error() == "invalid username format" || err.Error() == "password is too short" || err.Error() == "file size exceeds 200KB" || err.Error() == "invalid file type" {
+		if errors.Is(err, models.ErrInvalidProfile) {
 			util.RespondWithError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		util.RespondWithError(w, http.StatusInternalServerError, "Failed to update profile")
+		util.RespondWithInternalError(w, r, err, "Failed to update profile")
 		return
 	}
 
 	util.RespondWithJSON(w, http.StatusOK, user)
 }
 
+func optionalFormValue(r *http.Request, key string) *string {
+	if values, ok := r.MultipartForm.Value[key]; ok && len(values) > 0 {
+		return &values[0]
+	}
+	return nil
+}
+
+type setStatusRequest struct {
+	Text      string     `json:"text"`
+	Emoji     string     `json:"emoji"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (h *UserHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req setStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	user, err := h.userUsecase.SetStatus(r.Context(), userID, req.Text, req.Emoji, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, models.ErrInvalidProfile):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Failed to set status")
+		}
+		return
+	}
+
+	util.RespondWithJSON(w, http.StatusOK, user)
+}
+
+func (h *UserHandler) ClearStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if _, err := h.userUsecase.SetStatus(r.Context(), userID, "", "", nil); err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Failed to clear status")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req deleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	if err := h.userUsecase.DeleteAccount(r.Context(), userID, req.Password, util.ClientIP(r)); err != nil {
+		if respondIfLockedOut(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			util.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, models.ErrUserNotFound):
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			util.RespondWithInternalError(w, r, err, "Failed to delete account")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Build the archive in memory so that a failure can still be reported
+	// with a proper status code.
+	var buf bytes.Buffer
+	if err := h.userUsecase.ExportData(r.Context(), userID, &buf); err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			util.RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		util.RespondWithInternalError(w, r, err, "Failed to export data")
+		return
+	}
+
+	filename := fmt.Sprintf("quikchat-export-%s.zip", time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
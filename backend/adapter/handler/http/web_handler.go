@@ -2,8 +2,9 @@ package http
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"path/filepath"
 )
 
@@ -14,7 +15,8 @@ type WebHandler struct {
 func NewWebHandler(templatesDir string) *WebHandler {
 	tpl, err := template.ParseGlob(filepath.Join(templatesDir, "*.html"))
 	if err != nil {
-		log.Fatalf("failed to parse templates: %v", err)
+		slog.Error("failed to parse templates", "err", err)
+		os.Exit(1)
 	}
 
 	return &WebHandler{
@@ -25,7 +27,7 @@ func NewWebHandler(templatesDir string) *WebHandler {
 func (h *WebHandler) ServeApp(w http.ResponseWriter, r *http.Request) {
 	err := h.templates.ExecuteTemplate(w, "app.html", nil)
 	if err != nil {
-		log.Printf("Error executing template: %v", err)
+		slog.ErrorContext(r.Context(), "failed to execute template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
@@ -2,18 +2,25 @@ package ws
 
 import (
 	"bytes"
-	"log"
+	"context"
+	"log/slog"
+	"sync"
 	"time"
 
+	"chat-app/backend/adapter/metrics"
+	"chat-app/backend/adapter/util"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	maxMessageSize = 2048 // Room for an "auth" frame carrying an RS256 token
 )
 
 var (
@@ -30,6 +37,72 @@ type Client struct {
 	send chan []byte
 	// Authenticated user ID.
 	userID uuid.UUID
+	// ctx carries the connection and user IDs into log records and down
+	// to the usecases called on the client's behalf.
+	ctx context.Context
+	// connSpan is the span of the upgrade request, which the spans of
+	// individual frames link back to.
+	connSpan trace.SpanContext
+	// Expiry of the access token that authenticated the connection. The
+	// connection is closed when it passes unless the client re-authenticates.
+	tokenExpiresAt time.Time
+	expiryTimer    *time.Timer
+	// Token bucket for every inbound frame on this connection.
+	limiter *rate.Limiter
+	// Throttling violations so far. Only touched by the hub goroutine.
+	violations int
+	// Whether the hub has closed send. Only touched by the hub goroutine.
+	sendClosed bool
+	// Close frame sent when the hub closes the send channel.
+	closeMessage []byte
+	mu           sync.Mutex
+}
+
+func newClient(ctx context.Context, hub *Hub, conn *websocket.Conn, userID uuid.UUID, tokenExpiresAt time.Time) *Client {
+	ctx = util.WithLogAttrs(ctx,
+		slog.String("conn_id", uuid.NewString()),
+		slog.String("user_id", userID.String()))
+	return &Client{
+		hub:            hub,
+		conn:           conn,
+		send:           make(chan []byte, 256),
+		userID:         userID,
+		ctx:            ctx,
+		connSpan:       trace.SpanContextFromContext(ctx),
+		tokenExpiresAt: tokenExpiresAt,
+		expiryTimer:    time.NewTimer(time.Until(tokenExpiresAt)),
+		limiter:        rate.NewLimiter(hub.flood.FrameRate, hub.flood.FrameBurst),
+		closeMessage:   []byte{},
+	}
+}
+
+// setTokenExpiry records the expiry of a token presented for in-band
+// re-authentication and re-arms the expiry timer.
+func (c *Client) setTokenExpiry(expiresAt time.Time) {
+	c.mu.Lock()
+	c.tokenExpiresAt = expiresAt
+	c.mu.Unlock()
+	c.expiryTimer.Reset(time.Until(expiresAt))
+}
+
+// setCloseMessage sets the close frame written once the hub closes the send
+// channel.
+func (c *Client) setCloseMessage(code int, reason string) {
+	c.mu.Lock()
+	c.closeMessage = websocket.FormatCloseMessage(code, reason)
+	c.mu.Unlock()
+}
+
+func (c *Client) getCloseMessage() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeMessage
+}
+
+func (c *Client) tokenExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !time.Now().Before(c.tokenExpiresAt)
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -45,10 +118,11 @@ func (c *Client) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				slog.WarnContext(c.ctx, "websocket read failed", "err", err)
 			}
 			break
 		}
+		metrics.WSFramesIn.Inc()
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
 		c.hub.broadcast <- &ClientMessage{client: c, message: message}
 	}
@@ -59,6 +133,7 @@ func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
+		c.expiryTimer.Stop()
 		c.conn.Close()
 	}()
 	for {
@@ -67,7 +142,7 @@ func (c *Client) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.getCloseMessage())
 				return
 			}
 
@@ -87,12 +162,21 @@ func (c *Client) writePump() {
 			if err := w.Close(); err != nil {
 				return
 			}
+			metrics.WSFramesOut.Add(float64(n + 1))
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-c.expiryTimer.C:
+			// The timer may have fired just before a re-authentication reset it.
+			if !c.tokenExpired() {
+				continue
+			}
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(CloseTokenExpired, "access token expired"),
+				time.Now().Add(writeWait))
+			return
 		}
 	}
 }
-
@@ -1,10 +1,15 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"chat-app/backend/adapter/middleware"
+	"chat-app/backend/models"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -19,20 +24,47 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// ServeWs handles websocket requests from the peer.
+// Time allowed for the client to send its "auth" frame after the upgrade.
+const authWait = 10 * time.Second
+
+// ServeWs handles websocket requests from the peer. Browsers cannot set an
+// Authorization header on a WebSocket, so the connection is authenticated by,
+// in order of preference: a single-use ticket in the "ticket" query parameter,
+// a user already placed in the context by the auth middleware, a bearer token
+// in the Authorization header, or an "auth" frame sent first after the upgrade.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID)
-	if !ok {
+	if hub.Closing() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Server restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, tokenExpiresAt, err := authenticateUpgrade(hub, r)
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		slog.WarnContext(r.Context(), "websocket upgrade failed", "err", err)
 		return
 	}
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), userID: userID}
+
+	if userID == uuid.Nil {
+		userID, tokenExpiresAt, err = authenticateFirstFrame(hub, conn)
+		if err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(CloseAuthFailed, "authentication failed"),
+				time.Now().Add(writeWait))
+			conn.Close()
+			return
+		}
+	}
+
+	// The request context is cancelled when this handler returns, but its
+	// values, including the request ID, stay useful for the connection.
+	client := newClient(context.WithoutCancel(r.Context()), hub, conn, userID, tokenExpiresAt)
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -40,3 +72,54 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	go client.writePump()
 	go client.readPump()
 }
+
+// authenticateUpgrade resolves the user from the upgrade request. It returns
+// uuid.Nil without an error when the request carries no credentials, deferring
+// authentication to the first frame.
+func authenticateUpgrade(hub *Hub, r *http.Request) (uuid.UUID, time.Time, error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return hub.authUsecase.RedeemWsTicket(r.Context(), ticket)
+	}
+
+	if userID, ok := r.Context().Value(middleware.UserIDKey).(uuid.UUID); ok {
+		expiresAt, _ := r.Context().Value(middleware.TokenExpiresAtKey).(time.Time)
+		return userID, expiresAt, nil
+	}
+
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		return validateToken(r.Context(), hub, token)
+	}
+
+	return uuid.Nil, time.Time{}, nil
+}
+
+// authenticateFirstFrame waits for an "auth" frame carrying an access token.
+func authenticateFirstFrame(hub *Hub, conn *websocket.Conn) (uuid.UUID, time.Time, error) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(authWait))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	if msg.Type != MessageTypeAuth {
+		return uuid.Nil, time.Time{}, models.ErrUnauthorized
+	}
+
+	var payload AuthPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return uuid.Nil, time.Time{}, models.ErrUnauthorized
+	}
+
+	return validateToken(context.Background(), hub, payload.Token)
+}
+
+func validateToken(ctx context.Context, hub *Hub, token string) (uuid.UUID, time.Time, error) {
+	claims, err := hub.authUsecase.ValidateAccessToken(ctx, token)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	return claims.UserID, claims.ExpiresAt, nil
+}
@@ -3,16 +3,59 @@ package ws
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"chat-app/backend/adapter/metrics"
+	"chat-app/backend/adapter/tracing"
+	"chat-app/backend/adapter/util"
 	"chat-app/backend/models"
+	"chat-app/backend/repository"
 	"chat-app/backend/usecase"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
+var tracer = tracing.Tracer("chat-app/backend/adapter/handler/ws")
+
+// maxFloodViolations is how many throttled frames a connection may send
+// before it is disconnected.
+const maxFloodViolations = 3
+
+// rateLimitTimeout bounds a shared rate limit check. The check runs on the hub
+// goroutine, so a slow store would otherwise hold up delivery for everyone
+// until the breaker opens.
+const rateLimitTimeout = 200 * time.Millisecond
+
+// Clients told the server is restarting are asked to wait reconnectDelay plus
+// up to reconnectJitter before reconnecting, so they do not all arrive at the
+// remaining replicas at once.
+const (
+	reconnectDelay  = time.Second
+	reconnectJitter = 4 * time.Second
+)
+
+// FloodControl bounds how fast clients may send.
+type FloodControl struct {
+	// FrameRate and FrameBurst form a token bucket applied to every inbound
+	// frame on a single connection.
+	FrameRate  rate.Limit
+	FrameBurst int
+	// UserMessages limits chat messages per user across all of their
+	// connections and every replica.
+	UserMessages models.RateLimitPolicy
+}
+
 // ClientMessage is a message from a client to the hub.
 type ClientMessage struct {
 	client  *Client
@@ -23,26 +66,55 @@ type ClientMessage struct {
 type Hub struct {
 	// Registered clients.
 	clients map[uuid.UUID]*Client
+	// Every connection whose pumps are still running, including clients
+	// replaced by a newer connection for the same user. Only touched by the
+	// hub goroutine.
+	live map[*Client]struct{}
 	// Inbound messages from the clients.
 	broadcast chan *ClientMessage
 	// Register requests from the clients.
 	register chan *Client
 	// Unregister requests from clients.
 	unregister chan *Client
+	// Liveness probes, answered by closing the channel sent.
+	ping chan chan struct{}
+	// Shutdown requests, answered with the connections being drained.
+	shutdown chan chan []*Client
+	// closing is set once Shutdown starts; new upgrades are refused.
+	closing atomic.Bool
+	// drained is closed once every connection has gone after Shutdown.
+	drained       chan struct{}
+	drainedClosed bool
 	// Event usecase
 	eventUsecase usecase.EventUsecase
 	groupUsecase usecase.GroupUsecase
-	mu           sync.RWMutex
+	authUsecase  usecase.AuthUsecase
+	userUsecase  usecase.UserUsecase
+	// Shared rate limit state for per-user limits and group slow mode.
+	rateLimitRepo repository.RateLimitRepository
+	// rateLimitBreaker skips the shared checks while the store is failing.
+	rateLimitBreaker *util.CircuitBreaker
+	flood            FloodControl
+	mu               sync.RWMutex
 }
 
-func NewHub(eventUsecase usecase.EventUsecase, groupUsecase usecase.GroupUsecase) *Hub {
+func NewHub(eventUsecase usecase.EventUsecase, groupUsecase usecase.GroupUsecase, authUsecase usecase.AuthUsecase, userUsecase usecase.UserUsecase, rateLimitRepo repository.RateLimitRepository, rateLimitBreaker *util.CircuitBreaker, flood FloodControl) *Hub {
 	return &Hub{
-		broadcast:    make(chan *ClientMessage),
-		register:     make(chan *Client),
-		unregister:   make(chan *Client),
-		clients:      make(map[uuid.UUID]*Client),
-		eventUsecase: eventUsecase,
-		groupUsecase: groupUsecase,
+		broadcast:        make(chan *ClientMessage),
+		register:         make(chan *Client),
+		unregister:       make(chan *Client),
+		ping:             make(chan chan struct{}),
+		shutdown:         make(chan chan []*Client),
+		drained:          make(chan struct{}),
+		clients:          make(map[uuid.UUID]*Client),
+		live:             make(map[*Client]struct{}),
+		eventUsecase:     eventUsecase,
+		groupUsecase:     groupUsecase,
+		authUsecase:      authUsecase,
+		userUsecase:      userUsecase,
+		rateLimitRepo:    rateLimitRepo,
+		rateLimitBreaker: rateLimitBreaker,
+		flood:            flood,
 	}
 }
 
@@ -50,19 +122,153 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			h.live[client] = struct{}{}
+			if h.closing.Load() {
+				// Upgraded just as shutdown started.
+				h.sendRestarting(client)
+				continue
+			}
 			h.mu.Lock()
 			h.clients[client.userID] = client
+			metrics.WSConnections.Set(float64(len(h.clients)))
 			h.mu.Unlock()
+			slog.InfoContext(client.ctx, "websocket connected")
+			go h.touchLastSeen(client)
 		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client.userID]; ok {
-				delete(h.clients, client.userID)
-				close(client.send)
-			}
-			h.mu.Unlock()
+			delete(h.live, client)
+			h.removeClient(client)
+			h.checkDrained()
 		case clientMessage := <-h.broadcast:
 			h.handleMessage(clientMessage.client, clientMessage.message)
+		case reply := <-h.ping:
+			close(reply)
+		case reply := <-h.shutdown:
+			reply <- h.drainClients()
+		}
+	}
+}
+
+// Closing reports whether Shutdown has started.
+func (h *Hub) Closing() bool {
+	return h.closing.Load()
+}
+
+// Shutdown tells every connected client that the server is restarting and
+// closes each connection with CloseServiceRestart once the frames already
+// queued for it have been written. Connections opened afterwards are closed
+// the same way. It returns once every connection is gone, or closes the
+// remaining ones forcibly when ctx is done. The hub loop keeps running so
+// that the pumps can unregister.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.closing.Store(true)
+
+	reply := make(chan []*Client, 1)
+	select {
+	case h.shutdown <- reply:
+	case <-ctx.Done():
+		return fmt.Errorf("hub loop not responding: %w", ctx.Err())
+	}
+	clients := <-reply
+
+	select {
+	case <-h.drained:
+		return nil
+	case <-ctx.Done():
+		for _, client := range clients {
+			client.conn.Close()
+		}
+		return fmt.Errorf("%d websocket connections not drained: %w", len(clients), ctx.Err())
+	}
+}
+
+// drainClients sends every live connection the restart notice and returns
+// them. It runs on the hub goroutine.
+func (h *Hub) drainClients() []*Client {
+	slog.Info("draining websocket connections", "connections", len(h.live))
+	clients := make([]*Client, 0, len(h.live))
+	for client := range h.live {
+		clients = append(clients, client)
+		h.mu.Lock()
+		if c, ok := h.clients[client.userID]; ok && c == client {
+			delete(h.clients, client.userID)
+			go h.touchLastSeen(client)
 		}
+		h.mu.Unlock()
+		h.sendRestarting(client)
+	}
+	metrics.WSConnections.Set(0)
+	h.checkDrained()
+	return clients
+}
+
+// sendRestarting queues a "server_restarting" frame for client and closes its
+// send channel, so the write pump flushes what is queued and then closes the
+// connection.
+func (h *Hub) sendRestarting(client *Client) {
+	if client.sendClosed {
+		return
+	}
+	delay := reconnectDelay + rand.N(reconnectJitter)
+	h.sendControl(client, MessageTypeServerRestarting, ServerRestartingPayload{
+		ReconnectAfterMs: delay.Milliseconds(),
+	})
+	client.setCloseMessage(websocket.CloseServiceRestart, "server restarting")
+	h.closeSend(client)
+}
+
+// closeSend closes the send channel of client unless it already is. It runs on
+// the hub goroutine.
+func (h *Hub) closeSend(client *Client) {
+	if !client.sendClosed {
+		client.sendClosed = true
+		close(client.send)
+	}
+}
+
+// checkDrained closes h.drained once shutdown has started and no connection
+// is left.
+func (h *Hub) checkDrained() {
+	if h.closing.Load() && len(h.live) == 0 && !h.drainedClosed {
+		h.drainedClosed = true
+		close(h.drained)
+	}
+}
+
+// Ping reports whether the hub loop is still taking work off its channels.
+// It fails if the loop does not answer before ctx is done.
+func (h *Hub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case h.ping <- reply:
+	case <-ctx.Done():
+		return fmt.Errorf("hub loop not responding: %w", ctx.Err())
+	}
+	<-reply
+	return nil
+}
+
+// removeClient drops client from the hub and closes its send channel. A user
+// who reconnected has already been replaced by a newer client, which is left
+// alone.
+func (h *Hub) removeClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.clients[client.userID]; ok && c == client {
+		delete(h.clients, client.userID)
+		metrics.WSConnections.Set(float64(len(h.clients)))
+		h.closeSend(client)
+		slog.InfoContext(client.ctx, "websocket disconnected")
+		go h.touchLastSeen(client)
+	}
+}
+
+// touchLastSeen records presence off the hub goroutine so a slow database
+// does not hold up message delivery.
+func (h *Hub) touchLastSeen(client *Client) {
+	ctx, cancel := context.WithTimeout(client.ctx, 5*time.Second)
+	defer cancel()
+	if err := h.userUsecase.TouchLastSeen(ctx, client.userID); err != nil {
+		slog.WarnContext(ctx, "failed to update last seen", "err", err)
 	}
 }
 
@@ -73,35 +279,65 @@ func (h *Hub) GetClientCount() int {
 }
 
 func (h *Hub) handleMessage(sender *Client, rawMessage []byte) {
+	// Frames already in flight from a client that has been disconnected.
+	h.mu.RLock()
+	registered := h.clients[sender.userID] == sender
+	h.mu.RUnlock()
+	if !registered {
+		return
+	}
+
+	// Each frame starts its own trace, linked to the upgrade request rather
+	// than nested under it, as a connection can stay open for hours.
+	ctx, span := tracer.Start(sender.ctx, "ws frame",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithLinks(trace.Link{SpanContext: sender.connSpan}),
+		trace.WithAttributes(attribute.String("user.id", sender.userID.String())))
+	defer span.End()
+
+	if !sender.limiter.Allow() {
+		h.throttle(sender, "rate_limited", "you are sending too fast", time.Duration(float64(time.Second)/float64(h.flood.FrameRate)))
+		return
+	}
+
 	var msg Message
 	if err := json.Unmarshal(rawMessage, &msg); err != nil {
-		log.Printf("error unmarshalling message: %v", err)
+		slog.WarnContext(ctx, "malformed frame", "err", err)
 		return
 	}
+	span.SetAttributes(attribute.String("ws.frame.type", msg.Type))
 
 	switch msg.Type {
 	case "message_sent":
 		var inbound InboundMessage
 		if err := json.Unmarshal(msg.Payload, &inbound); err != nil {
-			log.Printf("error unmarshalling inbound message payload: %v", err)
+			slog.WarnContext(ctx, "malformed message payload", "err", err)
 			return
 		}
 
 		content := strings.TrimSpace(inbound.Content)
 		if len(content) == 0 || len(content) > 200 {
-			log.Printf("invalid message length from user %s", sender.userID)
+			slog.DebugContext(ctx, "rejected message with invalid length", "length", len(content))
 			return
 		}
 		inbound.Content = content
 
-		h.processAndRelayMessage(sender.userID, inbound)
+		if result := h.allow(ctx, sender.userID.String(), h.flood.UserMessages); result != nil && !result.Allowed {
+			h.throttle(sender, "rate_limited", "you are sending messages too fast", result.RetryAfter)
+			return
+		}
+
+		h.processAndRelayMessage(ctx, sender, inbound)
+	case MessageTypeAuth:
+		h.reauthenticate(ctx, sender, msg.Payload)
 	default:
-		log.Printf("unknown message type: %s", msg.Type)
+		slog.WarnContext(ctx, "unknown frame type", "type", msg.Type)
 	}
 }
 
-func (h *Hub) processAndRelayMessage(senderID uuid.UUID, inbound InboundMessage) {
-	ctx := context.Background()
+func (h *Hub) processAndRelayMessage(ctx context.Context, sender *Client, inbound InboundMessage) {
+	senderID := sender.userID
 	outboundPayload := OutboundMessage{
 		ID:          uuid.New(),
 		Content:     inbound.Content,
@@ -118,9 +354,31 @@ func (h *Hub) processAndRelayMessage(senderID uuid.UUID, inbound InboundMessage)
 	if err == nil && group != nil {
 		members, err := h.groupUsecase.ListGroupMembers(ctx, group.ID)
 		if err != nil {
-			log.Printf("error listing group members: %v", err)
+			slog.ErrorContext(ctx, "failed to list group members", "group_id", group.ID, "err", err)
 			return
 		}
+		if !slices.ContainsFunc(members, func(member *models.User) bool { return member.ID == senderID }) {
+			h.sendError(sender, "not_group_member", "you are not a member of this group")
+			return
+		}
+		if group.SlowModeSeconds > 0 {
+			policy := models.RateLimitPolicy{
+				Name:   "slow_mode",
+				Limit:  1,
+				Period: time.Duration(group.SlowModeSeconds) * time.Second,
+				Burst:  1,
+			}
+			if result := h.allow(ctx, group.ID.String()+":"+senderID.String(), policy); result != nil && !result.Allowed {
+				// Slow mode is expected friction, not abuse, so it does not
+				// count towards a disconnect.
+				h.sendControl(sender, MessageTypeError, ErrorPayload{
+					Code:         "slow_mode",
+					Message:      "this group is in slow mode",
+					RetryAfterMs: result.RetryAfter.Milliseconds(),
+				})
+				return
+			}
+		}
 		for _, member := range members {
 			recipients = append(recipients, member.ID)
 		}
@@ -139,7 +397,7 @@ func (h *Hub) processAndRelayMessage(senderID uuid.UUID, inbound InboundMessage)
 			CreatedAt:   time.Now().UTC(),
 		}
 		if err := h.eventUsecase.StoreEvent(ctx, event); err != nil {
-			log.Printf("failed to store event: %v", err)
+			slog.ErrorContext(ctx, "failed to store message", "recipient_id", recipientID, "err", err)
 			continue
 		}
 		h.DeliverEvent(event)
@@ -148,40 +406,142 @@ func (h *Hub) processAndRelayMessage(senderID uuid.UUID, inbound InboundMessage)
 	// Send acknowledgment back to sender
 	ackPayload, err := json.Marshal(map[string]string{"messageId": outboundPayload.ID.String()})
 	if err != nil {
-		log.Printf("error marshalling ack payload: %v", err)
+		slog.ErrorContext(ctx, "failed to marshal ack payload", "err", err)
 		return
 	}
 
 	ackEvent := &models.Event{
-		ID:          uuid.New(), // New ID for the ack event itself
-		Type:        models.EventMessageAck,
-		Payload:     ackPayload,
-		RecipientID: senderID,
-		CreatedAt:   time.Now().UTC(),
+		ID:           uuid.New(), // New ID for the ack event itself
+		Type:         models.EventMessageAck,
+		Payload:      ackPayload,
+		RecipientID:  senderID,
+		CreatedAt:    time.Now().UTC(),
+		TraceContext: tracing.Inject(ctx),
 	}
 	h.DeliverEvent(ackEvent)
 }
 
+// reauthenticate accepts a fresh access token over an open connection so that
+// it is not closed when the token it was opened with expires.
+func (h *Hub) reauthenticate(ctx context.Context, client *Client, rawPayload json.RawMessage) {
+	var payload AuthPayload
+	if err := json.Unmarshal(rawPayload, &payload); err != nil {
+		h.sendError(client, "invalid_payload", "invalid auth payload")
+		return
+	}
+
+	claims, err := h.authUsecase.ValidateAccessToken(ctx, payload.Token)
+	if err != nil || claims.UserID != client.userID {
+		h.sendError(client, "auth_failed", "invalid or expired token")
+		return
+	}
+
+	client.setTokenExpiry(claims.ExpiresAt)
+	h.sendControl(client, MessageTypeAuthOK, map[string]string{
+		"expiresAt": claims.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// allow charges one request against policy. It fails open, returning nil,
+// when the rate limit store is unavailable, does not answer within
+// rateLimitTimeout or the breaker is open. The per-connection token bucket
+// still applies then.
+func (h *Hub) allow(ctx context.Context, key string, policy models.RateLimitPolicy) *models.RateLimitResult {
+	if policy.Limit <= 0 {
+		return nil
+	}
+	var result *models.RateLimitResult
+	err := h.rateLimitBreaker.Do(func() error {
+		ctx, cancel := context.WithTimeout(ctx, rateLimitTimeout)
+		defer cancel()
+		var err error
+		result, err = h.rateLimitRepo.Allow(ctx, key, policy)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, util.ErrCircuitOpen) {
+			slog.WarnContext(ctx, "rate limiter unavailable", "policy", policy.Name, "err", err)
+		}
+		return nil
+	}
+	return result
+}
+
+// throttle rejects a frame with an error and disconnects clients that keep
+// sending regardless. Runs on the hub goroutine.
+func (h *Hub) throttle(client *Client, code, message string, retryAfter time.Duration) {
+	client.violations++
+	h.sendControl(client, MessageTypeError, ErrorPayload{
+		Code:         code,
+		Message:      message,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+	if client.violations >= maxFloodViolations {
+		slog.WarnContext(client.ctx, "client flooding, disconnecting")
+		client.setCloseMessage(CloseRateLimited, "rate limit exceeded")
+		h.removeClient(client)
+	}
+}
+
+func (h *Hub) sendError(client *Client, code, message string) {
+	h.sendControl(client, MessageTypeError, ErrorPayload{Code: code, Message: message})
+}
+
+// sendControl queues a frame for a single connection. Control frames are not
+// persisted, so they are dropped rather than blocking when the buffer is full.
+func (h *Hub) sendControl(client *Client, messageType string, payload interface{}) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(client.ctx, "failed to marshal control payload", "type", messageType, "err", err)
+		return
+	}
+	frame, err := json.Marshal(Message{Type: messageType, Payload: payloadBytes})
+	if err != nil {
+		slog.ErrorContext(client.ctx, "failed to marshal control frame", "type", messageType, "err", err)
+		return
+	}
+
+	select {
+	case client.send <- frame:
+	default:
+	}
+}
+
 // DeliverEvent sends a single event to a connected client if they are online.
+// The delivery is traced as part of the operation that created the event.
 func (h *Hub) DeliverEvent(event *models.Event) {
-	payload, err := json.Marshal(event)
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), event.TraceContext), "ws deliver",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("event.id", event.ID.String()),
+			attribute.String("event.type", string(event.Type)),
+		))
+	defer span.End()
+
+	// The trace context is for us, not for the client.
+	outbound := *event
+	outbound.TraceContext = nil
+	payload, err := json.Marshal(&outbound)
 	if err != nil {
-		log.Printf("error marshalling event for delivery: %v", err)
+		slog.ErrorContext(ctx, "failed to marshal event for delivery", "event_id", event.ID, "err", err)
 		return
 	}
 
 	h.mu.RLock()
 	client, ok := h.clients[event.RecipientID]
 	h.mu.RUnlock()
+	span.SetAttributes(attribute.Bool("ws.recipient_online", ok))
 
 	if ok {
 		select {
 		case client.send <- payload:
 		default:
 			// Client's send buffer is full, assume it's lagging and disconnect.
-			log.Printf("client %s lagging, disconnecting", client.userID)
-			h.unregister <- client
+			// This runs on the hub goroutine, which is the only reader of
+			// h.unregister, so the client is removed directly.
+			slog.WarnContext(client.ctx, "client lagging, disconnecting", "event_id", event.ID)
+			metrics.WSLaggingDisconnects.Inc()
+			h.removeClient(client)
 		}
 	}
 }
-
@@ -5,6 +5,26 @@ import (
 	"github.com/google/uuid"
 )
 
+// Inbound and control frame types.
+const (
+	MessageTypeAuth             = "auth"
+	MessageTypeAuthOK           = "auth_ok"
+	MessageTypeError            = "error"
+	MessageTypeServerRestarting = "server_restarting"
+)
+
+// Application close codes (RFC 6455 reserves 4000-4999 for private use).
+const (
+	// CloseAuthFailed is sent when the connection could not be authenticated.
+	CloseAuthFailed = 4001
+	// CloseTokenExpired is sent when the access token that authenticated the
+	// connection expired and the client did not re-authenticate in-band.
+	CloseTokenExpired = 4002
+	// CloseRateLimited is sent when a client keeps sending after being told
+	// to slow down.
+	CloseRateLimited = 4003
+)
+
 // Message represents a message sent over the WebSocket connection.
 type Message struct {
 	Type    string          `json:"type"`
@@ -17,6 +37,28 @@ type InboundMessage struct {
 	RecipientID uuid.UUID `json:"recipientId"` // Can be a user ID or group ID
 }
 
+// AuthPayload carries an access token for the first-frame handshake or for
+// in-band re-authentication of an open connection.
+type AuthPayload struct {
+	Token string `json:"token"`
+}
+
+// ErrorPayload is sent to a client in an "error" frame.
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// RetryAfterMs is set on throttling errors.
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+}
+
+// ServerRestartingPayload is sent in a "server_restarting" frame just before
+// the server closes the connection with websocket.CloseServiceRestart.
+type ServerRestartingPayload struct {
+	// ReconnectAfterMs is how long the client should wait before
+	// reconnecting. It is jittered so that clients spread out.
+	ReconnectAfterMs int64 `json:"reconnectAfterMs"`
+}
+
 // OutboundMessage represents a message sent to a client.
 type OutboundMessage struct {
 	ID          uuid.UUID `json:"id"`
@@ -25,4 +67,3 @@ type OutboundMessage struct {
 	RecipientID uuid.UUID `json:"recipientId"` // Can be a user ID or group ID
 	Timestamp   string    `json:"timestamp"`
 }
-
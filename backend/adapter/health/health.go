@@ -0,0 +1,128 @@
+// Package health runs the readiness checks behind /readyz.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values reported for the server and for each component.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check reports whether a component can serve traffic. It must return once
+// ctx is done.
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the outcome of one check.
+type ComponentStatus struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report is the outcome of all checks. Status is "ok" only if every
+// component is.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker holds the registered checks and whether the server is draining.
+type Checker struct {
+	checks   []namedCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewChecker returns a Checker that gives each check timeout to complete.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check. Checks must be registered before serving starts.
+func (c *Checker) Register(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining marks the server as shutting down, which fails readiness
+// regardless of the checks so load balancers stop sending new traffic.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Check runs every check concurrently, each under its own timeout.
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentStatus, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := nc.check(checkCtx)
+			status := ComponentStatus{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = StatusUnavailable
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Components[nc.name] = status
+			if err != nil {
+				report.Status = StatusUnavailable
+			}
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+// Heartbeat tracks when a background loop last completed successfully.
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+// NewHeartbeat returns a Heartbeat that counts as fresh from now.
+func NewHeartbeat() *Heartbeat {
+	h := &Heartbeat{}
+	h.Beat()
+	return h
+}
+
+// Beat records a successful run.
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Check fails once maxAge has passed without a Beat.
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		age := time.Since(time.Unix(0, h.last.Load()))
+		if age > maxAge {
+			return fmt.Errorf("last run %s ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer writes outgoing mail to the server log instead of sending it.
+// Meant for local development only: the log will contain live reset links.
+func NewLogMailer(from string) repository.Mailer {
+	return &logMailer{from: from}
+}
+
+func (m *logMailer) Send(ctx context.Context, email *models.Email) error {
+	slog.InfoContext(ctx, "email", "to", email.To, "message", string(buildMessage(m.from, email)))
+	return nil
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer writes every outgoing message to its own .eml file in dir,
+// where tests and developers can pick it up.
+func NewFileMailer(dir, from string) (repository.Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, email *models.Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, email), 0o600)
+}
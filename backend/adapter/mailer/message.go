@@ -0,0 +1,28 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"chat-app/backend/models"
+)
+
+// headerSanitizer strips line breaks so that values taken from user input
+// cannot inject extra headers.
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// buildMessage renders email as an RFC 5322 message.
+func buildMessage(from string, email *models.Email) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerSanitizer.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerSanitizer.Replace(email.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerSanitizer.Replace(email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mail through an SMTP relay. STARTTLS is used whenever
+// the server offers it, and credentials are only sent when username is set.
+func NewSMTPMailer(host, port, username, password, from string) repository.Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, email *models.Email) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{email.To}, buildMessage(m.from, email)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package metrics defines the Prometheus collectors exported on /metrics.
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "quikchat"
+
+var (
+	// HTTP
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// WebSocket
+	WSConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "connections",
+		Help:      "Open WebSocket connections registered with the hub.",
+	})
+	WSFramesIn = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "frames_received_total",
+		Help:      "Frames read from clients.",
+	})
+	WSFramesOut = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "frames_sent_total",
+		Help:      "Frames written to clients. Frames queued together share one WebSocket message.",
+	})
+	WSLaggingDisconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ws",
+		Name:      "lagging_disconnects_total",
+		Help:      "Clients disconnected because their send buffer was full.",
+	})
+
+	// Event persistence
+	EventBufferDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "buffer_depth",
+		Help:      "Events waiting in the Redis buffer to be persisted.",
+	})
+	EventFlushBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "flush_batch_size",
+		Help:      "Events per batch flushed from Redis to Postgres.",
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500},
+	})
+	EventFlushFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "flush_failures_total",
+		Help:      "Failed persistence worker steps, by stage.",
+	}, []string{"stage"})
+	EventsDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "dead_lettered_total",
+		Help:      "Events Postgres rejected, moved out of the buffer.",
+	})
+	JanitorDeletedRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "janitor",
+		Name:      "deleted_rows_total",
+		Help:      "Expired rows deleted by the janitor, by table.",
+	}, []string{"table"})
+)
+
+// Stages of the persistence worker reported by EventFlushFailures.
+const (
+	FlushStageRead       = "read"
+	FlushStageStore      = "store"
+	FlushStageDelete     = "delete"
+	FlushStageDeadLetter = "dead_letter"
+)
+
+// RegisterCircuitBreaker exports whether a circuit breaker is open.
+func RegisterCircuitBreaker(name string, open func() bool) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "circuit_breaker_open",
+		Help:        "Whether a circuit breaker is rejecting calls (1) or not (0).",
+		ConstLabels: prometheus.Labels{"breaker": name},
+	}, func() float64 {
+		if open() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
@@ -2,24 +2,28 @@ package middleware
 
 import (
 	"chat-app/backend/adapter/util"
+	"chat-app/backend/usecase"
 	"context"
+	"log/slog"
 	"net/http"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey         contextKey = "userID"
+	TokenExpiresAtKey contextKey = "tokenExpiresAt"
+	// SessionIDKey holds the refresh token family of the access token.
+	SessionIDKey contextKey = "sessionID"
+)
 
 type AuthMiddleware struct {
-	jwtSecret string
+	authUsecase usecase.AuthUsecase
 }
 
-func NewAuthMiddleware(jwtSecret string) *AuthMiddleware {
-	return &AuthMiddleware{jwtSecret: jwtSecret}
+func NewAuthMiddleware(authUsecase usecase.AuthUsecase) *AuthMiddleware {
+	return &AuthMiddleware{authUsecase: authUsecase}
 }
 
 func (m *AuthMiddleware) Validate(next http.Handler) http.Handler {
@@ -36,38 +40,16 @@ func (m *AuthMiddleware) Validate(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(m.jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			util.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			util.RespondWithError(w, http.StatusUnauthorized, "Invalid token claims")
-			return
-		}
-
-		userIDStr, ok := claims["user_id"].(string)
-		if !ok {
-			util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
-			return
-		}
-
-		userID, err := uuid.Parse(userIDStr)
+		claims, err := m.authUsecase.ValidateAccessToken(r.Context(), tokenString)
 		if err != nil {
-			util.RespondWithError(w, http.StatusUnauthorized, "Invalid user ID format in token")
+			util.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, TokenExpiresAtKey, claims.ExpiresAt)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		ctx = util.WithLogAttrs(ctx, slog.String("user_id", claims.UserID.String()))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
-
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"chat-app/backend/adapter/util"
+)
+
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRF enforces the double-submit cookie pattern on requests authenticated by
+// credentialCookie: the X-CSRF-Token header must echo the csrf_token cookie,
+// which a cross-site page cannot read. Requests without the credential cookie
+// carry their credentials explicitly and are not exposed to CSRF.
+func CSRF(credentialCookie string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := r.Cookie(credentialCookie); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			csrfCookie, err := r.Cookie(CSRFCookieName)
+			header := r.Header.Get(CSRFHeaderName)
+			if err != nil || csrfCookie.Value == "" || header == "" ||
+				subtle.ConstantTimeCompare([]byte(csrfCookie.Value), []byte(header)) != 1 {
+				util.RespondWithError(w, http.StatusForbidden, "CSRF token missing or invalid")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,16 +1,49 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"chat-app/backend/adapter/util"
+
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
+// RequestIDHeader echoes the request ID back so that clients can quote it
+// when reporting a problem.
+const RequestIDHeader = "X-Request-Id"
+
+// Logging attaches the request ID set by chiMiddleware.RequestID to the
+// request context, so that every record logged while serving the request
+// carries it, and logs one record per request once it completes.
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+		reqID := chiMiddleware.GetReqID(r.Context())
+		if reqID != "" {
+			w.Header().Set(RequestIDHeader, reqID)
+		}
+		ctx := util.WithLogAttrs(r.Context(), slog.String("request_id", reqID))
+
+		ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_ip", util.ClientIP(r),
+		)
 	})
 }
-
@@ -1,71 +1,71 @@
 package middleware
 
 import (
-	"net"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
-	"golang.org/x/time/rate"
-)
-
-type client struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
-}
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
 
-var (
-	clients = make(map[string]*client)
-	mu      sync.Mutex
+	"github.com/google/uuid"
 )
 
-func init() {
-	go cleanupClients()
+type RateLimiter struct {
+	repo repository.RateLimitRepository
 }
 
-func getClient(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+func NewRateLimiter(repo repository.RateLimitRepository) *RateLimiter {
+	return &RateLimiter{repo: repo}
+}
 
-	if c, exists := clients[ip]; exists {
-		c.lastSeen = time.Now()
-		return c.limiter
-	}
+// Limit enforces policy per caller. Authenticated requests are keyed by user
+// ID, so Validate must run first on protected routes; everything else is
+// keyed by client IP. A policy with a non-positive Limit is disabled.
+//
+// Responses carry the RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers, plus Retry-After when the request is rejected. If
+// Redis is unreachable the request is let through rather than taking the API
+// down with it.
+func (l *RateLimiter) Limit(policy models.RateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if policy.Limit <= 0 {
+			return next
+		}
 
-	// Allow 5 requests per second with a burst of 10.
-	limiter := rate.NewLimiter(5, 10)
-	clients[ip] = &client{limiter, time.Now()}
-	return limiter
-}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + util.ClientIP(r)
+			if userID, ok := r.Context().Value(UserIDKey).(uuid.UUID); ok {
+				key = "user:" + userID.String()
+			}
 
-func cleanupClients() {
-	for {
-		time.Sleep(time.Minute)
-		mu.Lock()
-		for ip, c := range clients {
-			if time.Since(c.lastSeen) > 3*time.Minute {
-				delete(clients, ip)
+			result, err := l.repo.Allow(r.Context(), key, policy)
+			if err != nil {
+				slog.WarnContext(r.Context(), "rate limiter unavailable", "policy", policy.Name, "err", err)
+				next.ServeHTTP(w, r)
+				return
 			}
-		}
-		mu.Unlock()
-	}
-}
 
-func RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			// Fallback for environments without a port
-			ip = r.RemoteAddr
-		}
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", policy.Limit, int(policy.Period.Seconds()), policy.Burst))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.ResetAfter))
 
-		limiter := getClient(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
-		}
+			if !result.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+				util.RespondWithError(w, http.StatusTooManyRequests, "Too Many Requests")
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chat-app/backend/models"
+
+	"github.com/google/uuid"
+)
+
+type fakeRateLimitRepo struct {
+	result *models.RateLimitResult
+	err    error
+	keys   []string
+}
+
+func (f *fakeRateLimitRepo) Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error) {
+	f.keys = append(f.keys, key)
+	return f.result, f.err
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	policy := models.RateLimitPolicy{Name: "test", Limit: 10, Period: time.Minute, Burst: 5}
+	userID := uuid.New()
+
+	tests := []struct {
+		name           string
+		policy         models.RateLimitPolicy
+		result         *models.RateLimitResult
+		err            error
+		userID         *uuid.UUID
+		wantStatus     int
+		wantKey        string
+		wantRetryAfter string
+	}{
+		{
+			name:       "disabled policy skips the store",
+			policy:     models.RateLimitPolicy{Name: "off"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed by IP",
+			policy:     policy,
+			result:     &models.RateLimitResult{Allowed: true, Remaining: 4, ResetAfter: 6 * time.Second},
+			wantStatus: http.StatusOK,
+			wantKey:    "ip:192.0.2.1",
+		},
+		{
+			name:       "allowed by user",
+			policy:     policy,
+			result:     &models.RateLimitResult{Allowed: true, Remaining: 4},
+			userID:     &userID,
+			wantStatus: http.StatusOK,
+			wantKey:    "user:" + userID.String(),
+		},
+		{
+			name:           "rejected",
+			policy:         policy,
+			result:         &models.RateLimitResult{Allowed: false, RetryAfter: 1500 * time.Millisecond, ResetAfter: 30 * time.Second},
+			wantStatus:     http.StatusTooManyRequests,
+			wantKey:        "ip:192.0.2.1",
+			wantRetryAfter: "2",
+		},
+		{
+			name:       "store unavailable fails open",
+			policy:     policy,
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusOK,
+			wantKey:    "ip:192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRateLimitRepo{result: tt.result, err: tt.err}
+			handler := NewRateLimiter(repo).Limit(tt.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.userID != nil {
+				req = req.WithContext(context.WithValue(req.Context(), UserIDKey, *tt.userID))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			switch {
+			case tt.wantKey == "" && len(repo.keys) != 0:
+				t.Errorf("store called with %v, want no call", repo.keys)
+			case tt.wantKey != "" && (len(repo.keys) != 1 || repo.keys[0] != tt.wantKey):
+				t.Errorf("store called with %v, want [%s]", repo.keys, tt.wantKey)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
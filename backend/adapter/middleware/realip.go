@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP rewrites RemoteAddr to the originating client address taken from
+// X-Forwarded-For, but only when the request arrived through one of the
+// trusted proxies. The header is walked from the right, skipping trusted
+// hops, so a client cannot spoof its address by prepending entries.
+func RealIP(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range trustedProxies {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(trustedProxies) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			peer := net.ParseIP(host)
+			if peer == nil || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					// A malformed entry means nothing to its left can be trusted.
+					break
+				}
+				if !isTrusted(ip) {
+					r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+					break
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+type postgresBlockRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresBlockRepository(db *sql.DB) repository.BlockRepository {
+	return &postgresBlockRepository{db: db}
+}
+
+func (r *postgresBlockRepository) Block(ctx context.Context, blockerID, blockedID uuid.UUID) error {
+	query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := r.db.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresBlockRepository) Unblock(ctx context.Context, blockerID, blockedID uuid.UUID) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+	res, err := r.db.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return models.ErrBlockNotFound
+	}
+	return nil
+}
+
+func (r *postgresBlockRepository) IsBlocked(ctx context.Context, blockerID, blockedID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+	var blocked bool
+	if err := r.db.QueryRowContext(ctx, query, blockerID, blockedID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+func (r *postgresBlockRepository) ListBlocked(ctx context.Context, blockerID uuid.UUID) ([]*models.User, error) {
+	query := `
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at
+		FROM users u
+		JOIN user_blocks b ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
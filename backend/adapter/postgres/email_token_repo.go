@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+type postgresEmailTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresEmailTokenRepository(db *sql.DB) repository.EmailTokenRepository {
+	return &postgresEmailTokenRepository{db: db}
+}
+
+func (r *postgresEmailTokenRepository) Create(ctx context.Context, token *models.EmailToken) error {
+	query := `INSERT INTO email_tokens (token_hash, user_id, purpose, email, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, query, token.TokenHash, token.UserID, token.Purpose, token.Email, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create email token: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresEmailTokenRepository) Consume(ctx context.Context, tokenHash string, purpose models.EmailTokenPurpose) (*models.EmailToken, error) {
+	// Deleting as part of the lookup makes the token single-use even under
+	// concurrent requests.
+	query := `
+		DELETE FROM email_tokens
+		WHERE token_hash = $1 AND purpose = $2
+		RETURNING token_hash, user_id, purpose, email, expires_at
+	`
+	token := &models.EmailToken{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose).Scan(&token.TokenHash, &token.UserID, &token.Purpose, &token.Email, &token.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrEmailTokenInvalid
+		}
+		return nil, fmt.Errorf("failed to consume email token: %w", err)
+	}
+	return token, nil
+}
+
+func (r *postgresEmailTokenRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID, purpose models.EmailTokenPurpose) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2`, userID, purpose)
+	return err
+}
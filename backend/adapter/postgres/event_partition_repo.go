@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"chat-app/backend/repository"
+
+	"github.com/lib/pq"
+)
+
+// eventPartitionLayout names the partition of events for a month, matching
+// migrations/optional/partition_events.sql.
+const eventPartitionLayout = "events_2006_01"
+
+type postgresEventPartitionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresEventPartitionRepository(db *sql.DB) repository.EventPartitionRepository {
+	return &postgresEventPartitionRepository{db: db}
+}
+
+func (r *postgresEventPartitionRepository) EnsurePartitions(ctx context.Context, from time.Time, months int) error {
+	from = from.UTC()
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < months; i++ {
+		next := month.AddDate(0, 1, 0)
+		// DDL takes no parameters, so the values are quoted here.
+		query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF events FOR VALUES FROM (%s) TO (%s)`,
+			pq.QuoteIdentifier(month.Format(eventPartitionLayout)),
+			pq.QuoteLiteral(month.Format(time.RFC3339)),
+			pq.QuoteLiteral(next.Format(time.RFC3339)))
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", month.Format(eventPartitionLayout), err)
+		}
+		month = next
+	}
+	return nil
+}
+
+func (r *postgresEventPartitionRepository) DropPartitionsBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	query := `SELECT c.relname
+              FROM pg_inherits i
+              JOIN pg_class c ON c.oid = i.inhrelid
+              WHERE i.inhparent = 'events'::regclass`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// Partitions not named after a month, such as events_default, are
+		// never dropped.
+		month, err := time.Parse(eventPartitionLayout, name)
+		if err != nil {
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, name := range expired {
+		if _, err := r.db.ExecContext(ctx, `DROP TABLE `+pq.QuoteIdentifier(name)); err != nil {
+			return dropped, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
@@ -3,6 +3,10 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"chat-app/backend/models"
@@ -22,45 +26,57 @@ func NewPostgresEventRepository(db *sql.DB) repository.EventRepository {
 
 // These methods are for the Postgres part of the EventRepository interface
 func (r *postgresEventRepository) Store(ctx context.Context, event *models.Event) error {
-	query := `INSERT INTO events (id, type, payload, recipient_id, sender_id, created_at)
-              VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := r.db.ExecContext(ctx, query, event.ID, event.Type, event.Payload, event.RecipientID, event.SenderID, event.CreatedAt)
-	return err
+	query := `INSERT INTO events (id, type, payload, recipient_id, sender_id, created_at, trace_context)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)
+              ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.Type, event.Payload, event.RecipientID, event.SenderID, event.CreatedAt, traceContextValue(event))
+	return invalidEventError(err)
 }
 
+// StoreBatch inserts events in one statement. Events already stored, e.g.
+// because a worker died between storing a batch and acknowledging it in the
+// buffer, are skipped.
 func (r *postgresEventRepository) StoreBatch(ctx context.Context, events []*models.Event) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	const columns = 7
+	var query strings.Builder
+	query.WriteString(`INSERT INTO events (id, type, payload, recipient_id, sender_id, created_at, trace_context) VALUES `)
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, event := range events {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		args = append(args, event.ID, event.Type, event.Payload, event.RecipientID, event.SenderID, event.CreatedAt, traceContextValue(event))
 	}
-	defer tx.Rollback()
+	// No conflict target, as the key is (id, created_at) once events is
+	// partitioned.
+	query.WriteString(` ON CONFLICT DO NOTHING`)
 
-	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("events", "id", "type", "payload", "recipient_id", "sender_id", "created_at"))
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
+	_, err := r.db.ExecContext(ctx, query.String(), args...)
+	return invalidEventError(err)
+}
 
-	for _, event := range events {
-		_, err = stmt.ExecContext(ctx, event.ID, event.Type, event.Payload, event.RecipientID, event.SenderID, event.CreatedAt)
-		if err != nil {
-			return err
+// invalidEventError wraps errors caused by the event itself, such as a
+// recipient that no longer exists, in models.ErrInvalidEvent so that they
+// can be told apart from Postgres being unavailable.
+func invalidEventError(err error) error {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code.Class() {
+		case "22", "23": // data_exception, integrity_constraint_violation
+			return fmt.Errorf("%w: %v", models.ErrInvalidEvent, err)
 		}
 	}
-
-	if _, err = stmt.ExecContext(ctx); err != nil {
-		return err
-	}
-
-	return tx.Commit()
+	return err
 }
 
 func (r *postgresEventRepository) FetchUndelivered(ctx context.Context, userID uuid.UUID, cursor time.Time, limit int) ([]*models.Event, error) {
-	query := `SELECT id, type, payload, recipient_id, sender_id, created_at
+	query := `SELECT id, type, payload, recipient_id, sender_id, created_at, trace_context
               FROM events
               WHERE recipient_id = $1 AND created_at > $2
               ORDER BY created_at ASC
@@ -75,20 +91,92 @@ func (r *postgresEventRepository) FetchUndelivered(ctx context.Context, userID u
 	var events []*models.Event
 	for rows.Next() {
 		var event models.Event
-		if err := rows.Scan(&event.ID, &event.Type, &event.Payload, &event.RecipientID, &event.SenderID, &event.CreatedAt); err != nil {
+		var traceContext []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.Payload, &event.RecipientID, &event.SenderID, &event.CreatedAt, &traceContext); err != nil {
 			return nil, err
 		}
+		if traceContext != nil {
+			// A damaged trace context only costs the link to the sender.
+			_ = json.Unmarshal(traceContext, &event.TraceContext)
+		}
 		events = append(events, &event)
 	}
 	return events, nil
 }
 
+// traceContextValue encodes the event's trace context for the JSONB column,
+// storing NULL when there is none.
+func traceContextValue(event *models.Event) interface{} {
+	if len(event.TraceContext) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(event.TraceContext)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
 func (r *postgresEventRepository) Delete(ctx context.Context, eventID uuid.UUID) error {
 	query := `DELETE FROM events WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, eventID)
 	return err
 }
 
+func (r *postgresEventRepository) ListMessages(ctx context.Context, userID uuid.UUID) ([]*models.Event, error) {
+	// A message is fanned out as one event per recipient, so the sender's
+	// copies are collapsed on the message ID carried in the payload.
+	query := `SELECT id, type, payload, recipient_id, sender_id, created_at FROM (
+                  SELECT DISTINCT ON (payload->>'id') id, type, payload, recipient_id, sender_id, created_at
+                  FROM events
+                  WHERE type = $2 AND (recipient_id = $1 OR sender_id = $1)
+                  ORDER BY payload->>'id', created_at
+              ) m
+              ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, models.EventMessageSent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.Payload, &event.RecipientID, &event.SenderID, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+func (r *postgresEventRepository) DeleteTypeBefore(ctx context.Context, eventType models.EventType, cutoff time.Time, limit int) (int64, error) {
+	query := `DELETE FROM events WHERE id IN (
+                  SELECT id FROM events WHERE type = $1 AND created_at < $2 LIMIT $3
+              )`
+	res, err := r.db.ExecContext(ctx, query, eventType, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *postgresEventRepository) DeleteBeforeExcept(ctx context.Context, cutoff time.Time, exceptTypes []models.EventType, limit int) (int64, error) {
+	types := make([]string, len(exceptTypes))
+	for i, t := range exceptTypes {
+		types[i] = string(t)
+	}
+	query := `DELETE FROM events WHERE id IN (
+                  SELECT id FROM events WHERE created_at < $1 AND type <> ALL($2) LIMIT $3
+              )`
+	res, err := r.db.ExecContext(ctx, query, cutoff, pq.Array(types), limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // These methods are for the Redis part of the interface, so they are no-ops here.
 func (r *postgresEventRepository) BufferEvent(ctx context.Context, event *models.Event) error {
 	return nil // No-op
@@ -99,3 +187,9 @@ func (r *postgresEventRepository) GetBufferedEvents(ctx context.Context, count i
 func (r *postgresEventRepository) DeleteBufferedEvents(ctx context.Context, events []*models.Event) error {
 	return nil // No-op
 }
+func (r *postgresEventRepository) CountBufferedEvents(ctx context.Context) (int64, error) {
+	return 0, nil // No-op
+}
+func (r *postgresEventRepository) DeadLetterBufferedEvent(ctx context.Context, event *models.Event, reason string) error {
+	return nil // No-op
+}
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
@@ -93,7 +92,7 @@ func (r *postgresFriendshipRepository) Find(ctx context.Context, userID1, userID
 
 func (r *postgresFriendshipRepository) ListByUserID(ctx context.Context, userID uuid.UUID, status models.FriendshipStatus) ([]*models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.profile_pic_url, u.created_at
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at
 		FROM users u
 		JOIN friendships f ON (u.id = f.user_id1 OR u.id = f.user_id2)
 		WHERE (f.user_id1 = $1 OR f.user_id2 = $1)
@@ -102,7 +101,6 @@ func (r *postgresFriendshipRepository) ListByUserID(ctx context.Context, userID
 	`
 	rows, err := r.db.QueryContext(ctx, query, userID, status)
 	if err != nil {
-		log.Println("Error obtaining friends:", err)
 		return nil, fmt.Errorf("failed to list friends: %w", err)
 	}
 	defer rows.Close()
@@ -110,11 +108,68 @@ func (r *postgresFriendshipRepository) ListByUserID(ctx context.Context, userID
 	users := make([]*models.User, 0)
 	for rows.Next() {
 		user := &models.User{}
-		if err := rows.Scan(&user.ID, &user.Username, &user.ProfilePicURL, &user.CreatedAt); err != nil {
-			log.Println("Error obtaining friends:", err)
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 		users = append(users, user)
 	}
 	return users, nil
 }
+
+func (r *postgresFriendshipRepository) ListSuggestions(ctx context.Context, userID uuid.UUID, limit int) ([]*models.FriendSuggestion, error) {
+	// A mutual friend counts double a shared group: groups can be large and
+	// say less about whether two people know each other.
+	query := `
+		WITH my_friends AS (
+			SELECT CASE WHEN user_id1 = $1 THEN user_id2 ELSE user_id1 END AS id
+			FROM friendships
+			WHERE (user_id1 = $1 OR user_id2 = $1) AND status = $3
+		),
+		mutual AS (
+			SELECT CASE WHEN f.user_id1 = mf.id THEN f.user_id2 ELSE f.user_id1 END AS id, COUNT(*) AS n
+			FROM friendships f
+			JOIN my_friends mf ON mf.id = f.user_id1 OR mf.id = f.user_id2
+			WHERE f.status = $3
+			GROUP BY 1
+		),
+		shared AS (
+			SELECT other.user_id AS id, COUNT(*) AS n
+			FROM group_members mine
+			JOIN group_members other ON other.group_id = mine.group_id
+			WHERE mine.user_id = $1 AND other.user_id <> $1
+			GROUP BY other.user_id
+		)
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at,
+			COALESCE(m.n, 0) AS mutual_friends, COALESCE(s.n, 0) AS shared_groups
+		FROM mutual m
+		FULL OUTER JOIN shared s ON s.id = m.id
+		JOIN users u ON u.id = COALESCE(m.id, s.id)
+		WHERE u.id <> $1
+		AND NOT EXISTS (
+			SELECT 1 FROM friendships f
+			WHERE (f.user_id1 = $1 AND f.user_id2 = u.id) OR (f.user_id1 = u.id AND f.user_id2 = $1)
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+		)
+		ORDER BY 2 * COALESCE(m.n, 0) + COALESCE(s.n, 0) DESC, mutual_friends DESC, u.username
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, models.FriendshipStatusAccepted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list friend suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := make([]*models.FriendSuggestion, 0)
+	for rows.Next() {
+		user := &models.User{}
+		suggestion := &models.FriendSuggestion{User: user}
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt, &suggestion.MutualFriends, &suggestion.SharedGroups); err != nil {
+			return nil, fmt.Errorf("failed to scan suggestion row: %w", err)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
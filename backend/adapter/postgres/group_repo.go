@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
@@ -28,8 +29,8 @@ func (r *postgresGroupRepository) Create(ctx context.Context, group *models.Grou
 	}
 	defer tx.Rollback()
 
-	query := `INSERT INTO groups (id, handle, name, photo_url, owner_id) VALUES ($1, $2, $3, $4, $5)`
-	_, err = tx.ExecContext(ctx, query, group.ID, group.Handle, group.Name, group.PhotoURL, group.OwnerID)
+	query := `INSERT INTO groups (id, handle, name, photo_url, owner_id, is_private) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, query, group.ID, group.Handle, group.Name, group.PhotoURL, group.OwnerID, group.IsPrivate)
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { // unique_violation
 			return models.ErrGroupHandleTaken
@@ -47,8 +48,8 @@ func (r *postgresGroupRepository) Create(ctx context.Context, group *models.Grou
 }
 
 func (r *postgresGroupRepository) Update(ctx context.Context, group *models.Group) error {
-	query := `UPDATE groups SET name = $2, photo_url = $3, owner_id = $4 WHERE id = $1`
-	res, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.PhotoURL, group.OwnerID)
+	query := `UPDATE groups SET name = $2, photo_url = $3, owner_id = $4, slow_mode_seconds = $5, is_private = $6 WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.PhotoURL, group.OwnerID, group.SlowModeSeconds, group.IsPrivate)
 	if err != nil {
 		return fmt.Errorf("failed to update group: %w", err)
 	}
@@ -69,9 +70,9 @@ func (r *postgresGroupRepository) Delete(ctx context.Context, groupID uuid.UUID)
 }
 
 func (r *postgresGroupRepository) FindByID(ctx context.Context, groupID uuid.UUID) (*models.Group, error) {
-	query := `SELECT id, handle, name, photo_url, owner_id, created_at FROM groups WHERE id = $1`
+	query := `SELECT id, handle, name, photo_url, owner_id, slow_mode_seconds, is_private, created_at FROM groups WHERE id = $1`
 	group := &models.Group{}
-	err := r.db.QueryRowContext(ctx, query, groupID).Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, groupID).Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.SlowModeSeconds, &group.IsPrivate, &group.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrGroupNotFound
@@ -82,9 +83,9 @@ func (r *postgresGroupRepository) FindByID(ctx context.Context, groupID uuid.UUI
 }
 
 func (r *postgresGroupRepository) FindByHandle(ctx context.Context, handle string) (*models.Group, error) {
-	query := `SELECT id, handle, name, photo_url, owner_id, created_at FROM groups WHERE LOWER(handle) = LOWER($1)`
+	query := `SELECT id, handle, name, photo_url, owner_id, slow_mode_seconds, is_private, created_at FROM groups WHERE LOWER(handle) = LOWER($1)`
 	group := &models.Group{}
-	err := r.db.QueryRowContext(ctx, query, handle).Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, handle).Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.SlowModeSeconds, &group.IsPrivate, &group.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrGroupNotFound
@@ -94,24 +95,60 @@ func (r *postgresGroupRepository) FindByHandle(ctx context.Context, handle strin
 	return group, nil
 }
 
-func (r *postgresGroupRepository) FuzzySearchByHandle(ctx context.Context, query string, limit int) ([]*models.Group, error) {
-	// Note: For true fuzzy search, extensions like pg_trgm are better. This is a simple LIKE search.
+func (r *postgresGroupRepository) Search(ctx context.Context, query string, limit, offset int) ([]*models.Group, error) {
+	// Handles look like "prefix#groupname", so a prefix of either part
+	// counts. Exact handle matches rank first, then prefix matches, then
+	// trigram similarity, with bigger groups breaking ties.
 	sqlQuery := `
-		SELECT id, handle, name, photo_url, owner_id, created_at
-		FROM groups
-		WHERE LOWER(handle) LIKE LOWER($1)
-		LIMIT $2
+		SELECT g.id, g.handle, g.name, g.photo_url, g.owner_id, g.slow_mode_seconds, g.is_private, g.created_at,
+			(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id) AS member_count
+		FROM groups g
+		WHERE NOT g.is_private
+		AND (LOWER(g.handle) LIKE $2 OR LOWER(g.name) LIKE $2 OR LOWER(g.handle) % $1 OR LOWER(g.name) % $1)
+		ORDER BY LOWER(g.handle) = $1 DESC,
+			(LOWER(g.handle) LIKE $3 OR split_part(LOWER(g.handle), '#', 2) LIKE $3 OR LOWER(g.name) LIKE $3) DESC,
+			GREATEST(similarity(LOWER(g.handle), $1), similarity(LOWER(g.name), $1)) DESC,
+			member_count DESC,
+			g.id
+		LIMIT $4 OFFSET $5
 	`
-	rows, err := r.db.QueryContext(ctx, sqlQuery, "%"+query+"%", limit)
+	query = strings.ToLower(query)
+	escaped := escapeLike(query)
+	rows, err := r.db.QueryContext(ctx, sqlQuery, query, "%"+escaped+"%", escaped+"%", limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search groups: %w", err)
 	}
 	defer rows.Close()
 
-	var groups []*models.Group
+	groups := make([]*models.Group, 0)
 	for rows.Next() {
 		group := &models.Group{}
-		if err := rows.Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.CreatedAt); err != nil {
+		if err := rows.Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.SlowModeSeconds, &group.IsPrivate, &group.CreatedAt, &group.MemberCount); err != nil {
+			return nil, fmt.Errorf("failed to scan group row: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (r *postgresGroupRepository) ListByMember(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	query := `
+		SELECT g.id, g.handle, g.name, g.photo_url, g.owner_id, g.slow_mode_seconds, g.is_private, g.created_at
+		FROM groups g
+		JOIN group_members gm ON g.id = gm.group_id
+		WHERE gm.user_id = $1
+		ORDER BY gm.joined_at
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups by member: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]*models.Group, 0)
+	for rows.Next() {
+		group := &models.Group{}
+		if err := rows.Scan(&group.ID, &group.Handle, &group.Name, &group.PhotoURL, &group.OwnerID, &group.SlowModeSeconds, &group.IsPrivate, &group.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan group row: %w", err)
 		}
 		groups = append(groups, group)
@@ -162,7 +199,7 @@ func (r *postgresGroupRepository) FindMember(ctx context.Context, groupID, userI
 
 func (r *postgresGroupRepository) ListMembers(ctx context.Context, groupID uuid.UUID) ([]*models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.profile_pic_url, u.created_at
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at
 		FROM users u
 		JOIN group_members gm ON u.id = gm.user_id
 		WHERE gm.group_id = $1
@@ -177,7 +214,7 @@ func (r *postgresGroupRepository) ListMembers(ctx context.Context, groupID uuid.
 	var users []*models.User
 	for rows.Next() {
 		user := &models.User{}
-		if err := rows.Scan(&user.ID, &user.Username, &user.ProfilePicURL, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 		users = append(users, user)
@@ -187,7 +224,7 @@ func (r *postgresGroupRepository) ListMembers(ctx context.Context, groupID uuid.
 
 func (r *postgresGroupRepository) GetOldestMember(ctx context.Context, groupID uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT u.id, u.username, u.profile_pic_url, u.created_at
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at
 		FROM users u
 		JOIN group_members gm ON u.id = gm.user_id
 		WHERE gm.group_id = $1
@@ -195,7 +232,7 @@ func (r *postgresGroupRepository) GetOldestMember(ctx context.Context, groupID u
 		LIMIT 1
 	`
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, groupID).Scan(&user.ID, &user.Username, &user.ProfilePicURL, &user.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, groupID).Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrGroupNotFound // Or no members, but group should have at least one
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+type postgresMessageSearchRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMessageSearchRepository(db *sql.DB) repository.MessageSearchRepository {
+	return &postgresMessageSearchRepository{db: db}
+}
+
+// Every message is stored once per recipient. A direct message has a single
+// copy, addressed to the recipient, whose payload names the same recipient;
+// a group message has one copy per member, whose payload names the group. The
+// scope below picks exactly one copy per message the caller can see: either
+// side's copy of a direct message, and the caller's own copy of a group
+// message while they remain in the group.
+//
+// The content is HTML-escaped before ts_headline so the snippet can be
+// rendered as markup with only the <mark> tags live.
+const messageSearchQuery = `
+	WITH scoped AS (
+		SELECT e.id, e.payload, e.sender_id, e.created_at,
+			CASE
+				WHEN (e.payload->>'recipientId')::uuid <> e.recipient_id THEN (e.payload->>'recipientId')::uuid
+				WHEN e.sender_id = $1 THEN e.recipient_id
+				ELSE e.sender_id
+			END AS conversation_id
+		FROM events e
+		WHERE e.type = 'message_sent'
+		AND e.search_vector @@ websearch_to_tsquery('simple', $2)
+		AND (
+			((e.payload->>'recipientId')::uuid = e.recipient_id AND (e.recipient_id = $1 OR e.sender_id = $1))
+			OR (e.recipient_id = $1 AND (e.payload->>'recipientId')::uuid IN (SELECT group_id FROM group_members WHERE user_id = $1))
+		)
+	)
+	SELECT s.id, (s.payload->>'id')::uuid, s.conversation_id, s.sender_id, s.payload->>'content',
+		ts_headline('simple',
+			replace(replace(replace(s.payload->>'content', '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+			websearch_to_tsquery('simple', $2),
+			'StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5, MaxFragments=2'),
+		s.created_at
+	FROM scoped s
+	WHERE ($3::uuid IS NULL OR s.sender_id = $3)
+	AND ($4::uuid IS NULL OR s.conversation_id = $4)
+	AND ($5::timestamptz IS NULL OR s.created_at >= $5)
+	AND ($6::timestamptz IS NULL OR s.created_at < $6)
+	AND ($7::timestamptz IS NULL OR (s.created_at, s.id) < ($7, $8::uuid))
+	ORDER BY s.created_at DESC, s.id DESC
+	LIMIT $9
+`
+
+func (r *postgresMessageSearchRepository) Search(ctx context.Context, userID uuid.UUID, query models.MessageSearchQuery) ([]*models.MessageSearchResult, error) {
+	var cursorTime, cursorID interface{}
+	if query.After != nil {
+		cursorTime, cursorID = query.After.CreatedAt, query.After.EventID
+	}
+
+	rows, err := r.db.QueryContext(ctx, messageSearchQuery, userID, query.Text,
+		query.SenderID, query.ConversationID, query.From, query.To, cursorTime, cursorID, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]*models.MessageSearchResult, 0)
+	for rows.Next() {
+		result := &models.MessageSearchResult{}
+		if err := rows.Scan(&result.EventID, &result.MessageID, &result.ConversationID, &result.SenderID, &result.Content, &result.Snippet, &result.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
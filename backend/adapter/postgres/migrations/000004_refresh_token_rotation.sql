@@ -0,0 +1,15 @@
+-- +migrate Up
+ALTER TABLE sessions ADD COLUMN family_id UUID;
+UPDATE sessions SET family_id = refresh_token WHERE family_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+
+ALTER TABLE sessions ADD COLUMN rotated_at TIMESTAMPTZ;
+ALTER TABLE sessions ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX idx_sessions_family_id ON sessions (family_id);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_sessions_family_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS created_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS family_id;
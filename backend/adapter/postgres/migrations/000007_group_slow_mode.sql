@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE groups ADD COLUMN slow_mode_seconds INTEGER NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0);
+
+-- +migrate Down
+ALTER TABLE groups DROP COLUMN IF EXISTS slow_mode_seconds;
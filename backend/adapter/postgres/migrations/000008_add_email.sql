@@ -0,0 +1,23 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN email VARCHAR(254);
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_users_email ON users (LOWER(email)) WHERE email IS NOT NULL;
+
+-- Single-use tokens sent by email. Only a SHA-256 of the token is stored.
+CREATE TABLE email_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL,
+    email VARCHAR(254) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_tokens_user_id ON email_tokens (user_id, purpose);
+
+-- +migrate Down
+DROP TABLE IF EXISTS email_tokens;
+DROP INDEX IF EXISTS idx_users_email;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
@@ -0,0 +1,18 @@
+-- +migrate Up
+ALTER TABLE users ADD COLUMN display_name VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_text VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_emoji VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status_expires_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN last_seen_visibility VARCHAR(10) NOT NULL DEFAULT 'everyone'
+    CHECK (last_seen_visibility IN ('everyone', 'friends', 'nobody'));
+
+-- +migrate Down
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_visibility;
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status_emoji;
+ALTER TABLE users DROP COLUMN IF EXISTS status_text;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,22 @@
+-- +migrate Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Usernames are stored lowercase, so the index serves both prefix (LIKE) and
+-- similarity (%) matches on the column directly.
+CREATE INDEX idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
+CREATE INDEX idx_users_display_name_trgm ON users USING GIN (LOWER(display_name) gin_trgm_ops);
+
+CREATE TABLE user_blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX idx_user_blocks_blocked_id ON user_blocks(blocked_id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS user_blocks;
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
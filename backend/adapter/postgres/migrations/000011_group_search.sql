@@ -0,0 +1,11 @@
+-- +migrate Up
+ALTER TABLE groups ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- pg_trgm is created in 000010.
+CREATE INDEX idx_groups_handle_trgm ON groups USING GIN (LOWER(handle) gin_trgm_ops) WHERE NOT is_private;
+CREATE INDEX idx_groups_name_trgm ON groups USING GIN (LOWER(name) gin_trgm_ops) WHERE NOT is_private;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_groups_name_trgm;
+DROP INDEX IF EXISTS idx_groups_handle_trgm;
+ALTER TABLE groups DROP COLUMN IF EXISTS is_private;
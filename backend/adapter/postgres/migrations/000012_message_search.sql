@@ -0,0 +1,12 @@
+-- +migrate Up
+-- The 'simple' configuration does no stemming or stop-word removal, which
+-- suits chat text in any language.
+ALTER TABLE events ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    CASE WHEN type = 'message_sent' THEN to_tsvector('simple', COALESCE(payload->>'content', '')) END
+) STORED;
+
+CREATE INDEX idx_events_search_vector ON events USING GIN (search_vector) WHERE type = 'message_sent';
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_events_search_vector;
+ALTER TABLE events DROP COLUMN IF EXISTS search_vector;
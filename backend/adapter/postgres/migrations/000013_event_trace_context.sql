@@ -0,0 +1,6 @@
+-- +migrate Up
+-- W3C trace context of the operation that created the event.
+ALTER TABLE events ADD COLUMN trace_context JSONB;
+
+-- +migrate Down
+ALTER TABLE events DROP COLUMN IF EXISTS trace_context;
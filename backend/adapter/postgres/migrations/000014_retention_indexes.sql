@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Let the janitor find expired rows without scanning the tables.
+CREATE INDEX idx_events_type_created_at ON events (type, created_at);
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_events_type_created_at;
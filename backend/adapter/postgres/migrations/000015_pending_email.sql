@@ -0,0 +1,11 @@
+-- +migrate Up
+-- Addresses waiting for verification now live only in their email_tokens row,
+-- so an unverified claim cannot block the real owner of an address.
+UPDATE users SET email = NULL WHERE NOT email_verified;
+
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (LOWER(email)) WHERE email_verified;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (LOWER(email)) WHERE email IS NOT NULL;
@@ -0,0 +1,88 @@
+-- Converts events into a table partitioned by month of created_at, so that
+-- the janitor can drop a month of expired events at once instead of
+-- deleting it row by row. This is not applied with the other migrations:
+-- run it in a maintenance window with the servers and workers stopped, then
+-- set EVENT_PARTITIONING=true.
+--
+-- Partitions are named events_YYYY_MM and cover calendar months in UTC.
+-- Postgres requires the partition key in every unique constraint, so the
+-- primary key becomes (id, created_at). Rows outside every monthly
+-- partition land in events_default; the janitor creates partitions ahead
+-- of time so that this does not happen.
+
+-- +migrate Up
+SET LOCAL timezone = 'UTC';
+
+ALTER TABLE events RENAME TO events_unpartitioned;
+ALTER INDEX events_pkey RENAME TO events_unpartitioned_pkey;
+ALTER INDEX idx_events_recipient_id_created_at RENAME TO idx_events_unpartitioned_recipient_id_created_at;
+ALTER INDEX idx_events_search_vector RENAME TO idx_events_unpartitioned_search_vector;
+ALTER INDEX idx_events_type_created_at RENAME TO idx_events_unpartitioned_type_created_at;
+
+CREATE TABLE events (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN type = 'message_sent' THEN to_tsvector('simple', COALESCE(payload->>'content', '')) END
+    ) STORED,
+    trace_context JSONB,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE INDEX idx_events_recipient_id_created_at ON events (recipient_id, created_at DESC);
+CREATE INDEX idx_events_search_vector ON events USING GIN (search_vector) WHERE type = 'message_sent';
+CREATE INDEX idx_events_type_created_at ON events (type, created_at);
+
+CREATE TABLE events_default PARTITION OF events DEFAULT;
+
+-- +migrate StatementBegin
+DO $$
+DECLARE
+    month TIMESTAMPTZ := date_trunc('month', COALESCE((SELECT MIN(created_at) FROM events_unpartitioned), NOW()));
+BEGIN
+    WHILE month <= date_trunc('month', NOW()) + INTERVAL '2 months' LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF events FOR VALUES FROM (%L) TO (%L)',
+            'events_' || to_char(month, 'YYYY_MM'), month, month + INTERVAL '1 month');
+        month := month + INTERVAL '1 month';
+    END LOOP;
+END
+$$;
+-- +migrate StatementEnd
+
+INSERT INTO events (id, type, payload, recipient_id, sender_id, created_at, trace_context)
+SELECT id, type, payload, recipient_id, sender_id, created_at, trace_context FROM events_unpartitioned;
+
+DROP TABLE events_unpartitioned;
+
+-- +migrate Down
+ALTER TABLE events RENAME TO events_partitioned;
+ALTER INDEX events_pkey RENAME TO events_partitioned_pkey;
+ALTER INDEX idx_events_recipient_id_created_at RENAME TO idx_events_partitioned_recipient_id_created_at;
+ALTER INDEX idx_events_search_vector RENAME TO idx_events_partitioned_search_vector;
+ALTER INDEX idx_events_type_created_at RENAME TO idx_events_partitioned_type_created_at;
+
+CREATE TABLE events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        CASE WHEN type = 'message_sent' THEN to_tsvector('simple', COALESCE(payload->>'content', '')) END
+    ) STORED,
+    trace_context JSONB
+);
+
+CREATE INDEX idx_events_recipient_id_created_at ON events (recipient_id, created_at DESC);
+CREATE INDEX idx_events_search_vector ON events USING GIN (search_vector) WHERE type = 'message_sent';
+CREATE INDEX idx_events_type_created_at ON events (type, created_at);
+
+INSERT INTO events (id, type, payload, recipient_id, sender_id, created_at, trace_context)
+SELECT id, type, payload, recipient_id, sender_id, created_at, trace_context FROM events_partitioned;
+
+DROP TABLE events_partitioned;
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+type postgresRecoveryCodeRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRecoveryCodeRepository(db *sql.DB) repository.RecoveryCodeRepository {
+	return &postgresRecoveryCodeRepository{db: db}
+}
+
+func (r *postgresRecoveryCodeRepository) ReplaceAll(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *postgresRecoveryCodeRepository) Consume(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return models.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (r *postgresRecoveryCodeRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	return err
+}
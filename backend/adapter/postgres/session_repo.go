@@ -6,6 +6,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,18 +22,16 @@ func NewPostgresSessionRepository(db *sql.DB) repository.SessionRepository {
 
 func (r *postgresSessionRepository) Create(ctx context.Context, session *models.Session) error {
 	query := `
-        INSERT INTO sessions (refresh_token, user_id, expires_at)
-        VALUES ($1, $2, $3)
-        ON CONFLICT (refresh_token) DO UPDATE SET
-        expires_at = EXCLUDED.expires_at`
-	_, err := r.db.ExecContext(ctx, query, session.RefreshToken, session.UserID, session.ExpiresAt)
+        INSERT INTO sessions (refresh_token, user_id, family_id, expires_at)
+        VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, session.RefreshToken, session.UserID, session.FamilyID, session.ExpiresAt)
 	return err
 }
 
 func (r *postgresSessionRepository) Find(ctx context.Context, refreshToken uuid.UUID) (*models.Session, error) {
-	query := `SELECT refresh_token, user_id, expires_at FROM sessions WHERE refresh_token = $1`
+	query := `SELECT refresh_token, user_id, family_id, expires_at, rotated_at, created_at FROM sessions WHERE refresh_token = $1`
 	session := &models.Session{}
-	err := r.db.QueryRowContext(ctx, query, refreshToken).Scan(&session.RefreshToken, &session.UserID, &session.ExpiresAt)
+	err := r.db.QueryRowContext(ctx, query, refreshToken).Scan(&session.RefreshToken, &session.UserID, &session.FamilyID, &session.ExpiresAt, &session.RotatedAt, &session.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrSessionNotFound
@@ -41,14 +41,68 @@ func (r *postgresSessionRepository) Find(ctx context.Context, refreshToken uuid.
 	return session, nil
 }
 
+func (r *postgresSessionRepository) Rotate(ctx context.Context, oldToken uuid.UUID, next *models.Session) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The rotated_at guard makes concurrent refreshes of the same token race
+	// safely: only one of them can win, the other is treated as reuse.
+	res, err := tx.ExecContext(ctx, `UPDATE sessions SET rotated_at = NOW() WHERE refresh_token = $1 AND rotated_at IS NULL`, oldToken)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return models.ErrRefreshTokenReused
+	}
+
+	query := `
+        INSERT INTO sessions (refresh_token, user_id, family_id, expires_at)
+        VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, next.RefreshToken, next.UserID, next.FamilyID, next.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to create rotated session: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 func (r *postgresSessionRepository) Delete(ctx context.Context, refreshToken uuid.UUID) error {
 	query := `DELETE FROM sessions WHERE refresh_token = $1`
 	_, err := r.db.ExecContext(ctx, query, refreshToken)
 	return err
 }
 
+func (r *postgresSessionRepository) DeleteByFamilyID(ctx context.Context, familyID uuid.UUID) error {
+	query := `DELETE FROM sessions WHERE family_id = $1`
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
 func (r *postgresSessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
 	query := `DELETE FROM sessions WHERE user_id = $1`
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+func (r *postgresSessionRepository) DeleteByUserIDExcept(ctx context.Context, userID, keepFamilyID uuid.UUID) error {
+	query := `DELETE FROM sessions WHERE user_id = $1 AND family_id <> $2`
+	_, err := r.db.ExecContext(ctx, query, userID, keepFamilyID)
+	return err
+}
+
+func (r *postgresSessionRepository) DeleteExpired(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	query := `DELETE FROM sessions WHERE refresh_token IN (
+                  SELECT refresh_token FROM sessions WHERE expires_at < $1 LIMIT $2
+              )`
+	res, err := r.db.ExecContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
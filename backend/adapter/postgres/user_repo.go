@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -32,35 +33,92 @@ func (r *postgresUserRepository) Create(ctx context.Context, user *models.User)
 	return nil
 }
 
-func (r *postgresUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
-	query := `SELECT id, username, password_hash, profile_pic_url, created_at FROM users WHERE LOWER(username) = $1`
+// userColumns is the column list read by scanUser.
+const userColumns = `id, username, display_name, bio, status_text, status_emoji, status_expires_at, password_hash, profile_pic_url,
+	last_seen_at, last_seen_visibility, COALESCE(totp_secret, ''), totp_enabled, is_admin, COALESCE(email, ''), email_verified, created_at`
+
+func scanUser(row *sql.Row) (*models.User, error) {
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, strings.ToLower(username)).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.ProfilePicURL, &user.CreatedAt)
+	var status models.UserStatus
+	var statusExpiresAt, lastSeenAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Bio, &status.Text, &status.Emoji, &statusExpiresAt, &user.PasswordHash, &user.ProfilePicURL,
+		&lastSeenAt, &user.LastSeenVisibility, &user.TOTPSecret, &user.TOTPEnabled, &user.IsAdmin, &user.Email, &user.EmailVerified, &user.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrUserNotFound
 		}
 		return nil, err
 	}
+	if status.Text != "" || status.Emoji != "" {
+		if statusExpiresAt.Valid {
+			status.ExpiresAt = &statusExpiresAt.Time
+		}
+		user.Status = &status
+	}
+	if lastSeenAt.Valid {
+		user.LastSeenAt = &lastSeenAt.Time
+	}
 	return user, nil
 }
 
+func (r *postgresUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(username) = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, strings.ToLower(username)))
+}
+
 func (r *postgresUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	query := `SELECT id, username, password_hash, profile_pic_url, created_at FROM users WHERE id = $1`
-	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.ProfilePicURL, &user.CreatedAt)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *postgresUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = $1 AND email_verified`
+	return scanUser(r.db.QueryRowContext(ctx, query, strings.ToLower(email)))
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (r *postgresUserRepository) Search(ctx context.Context, viewerID uuid.UUID, query string, limit int) ([]*models.User, error) {
+	// Prefix matches rank first, then the closer of the username and display
+	// name similarity.
+	sqlQuery := `
+		SELECT u.id, u.username, u.display_name, u.profile_pic_url, u.created_at
+		FROM users u
+		WHERE u.id <> $2
+		AND (u.username LIKE $3 OR LOWER(u.display_name) LIKE $3 OR u.username % $1 OR LOWER(u.display_name) % $1)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $2)
+		)
+		ORDER BY (u.username LIKE $3 OR LOWER(u.display_name) LIKE $3) DESC,
+			GREATEST(similarity(u.username, $1), similarity(LOWER(u.display_name), $1)) DESC,
+			u.username
+		LIMIT $4
+	`
+	query = strings.ToLower(query)
+	rows, err := r.db.QueryContext(ctx, sqlQuery, query, viewerID, escapeLike(query)+"%", limit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, models.ErrUserNotFound
-		}
 		return nil, err
 	}
-	return user, nil
+	defer rows.Close()
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.ProfilePicURL, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
 
 func (r *postgresUserRepository) Update(ctx context.Context, user *models.User) error {
-	query := `UPDATE users SET username = $1, password_hash = $2, profile_pic_url = $3 WHERE id = $4`
-	_, err := r.db.ExecContext(ctx, query, user.Username, user.PasswordHash, user.ProfilePicURL, user.ID)
+	query := `UPDATE users SET username = $1, password_hash = $2, profile_pic_url = $3, display_name = $4, bio = $5, last_seen_visibility = $6 WHERE id = $7`
+	_, err := r.db.ExecContext(ctx, query, user.Username, user.PasswordHash, user.ProfilePicURL, user.DisplayName, user.Bio, user.LastSeenVisibility, user.ID)
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
 			return models.ErrUsernameTaken
@@ -70,3 +128,97 @@ func (r *postgresUserRepository) Update(ctx context.Context, user *models.User)
 	return nil
 }
 
+func (r *postgresUserRepository) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, userID)
+	return err
+}
+
+func (r *postgresUserRepository) UpdateStatus(ctx context.Context, userID uuid.UUID, status *models.UserStatus) error {
+	if status == nil {
+		status = &models.UserStatus{}
+	}
+	query := `UPDATE users SET status_text = $2, status_emoji = $3, status_expires_at = $4 WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, userID, status.Text, status.Emoji, status.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) UpdateLastSeen(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	query := `UPDATE users SET last_seen_at = $2 WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID, at)
+	return err
+}
+
+func (r *postgresUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM users WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) UpdateEmail(ctx context.Context, userID uuid.UUID, email string, verified bool) error {
+	query := `UPDATE users SET email = NULLIF($2, ''), email_verified = $3 WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, userID, email, verified)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return models.ErrEmailTaken
+		}
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error {
+	query := `UPDATE users SET totp_secret = NULLIF($2, ''), totp_enabled = $3, totp_last_step = NULL WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, userID, secret, enabled)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) MarkTOTPStepUsed(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $2 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`
+	res, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
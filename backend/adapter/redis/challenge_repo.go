@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	loginChallengeKeyPrefix   = "login_challenge:"
+	loginChallengeAttemptsKey = ":attempts"
+)
+
+type redisLoginChallengeRepository struct {
+	rdb *redis.Client
+}
+
+func NewRedisLoginChallengeRepository(rdb *redis.Client) repository.LoginChallengeRepository {
+	return &redisLoginChallengeRepository{rdb: rdb}
+}
+
+func (r *redisLoginChallengeRepository) Create(ctx context.Context, challenge *models.LoginChallenge, ttl time.Duration) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, loginChallengeKeyPrefix+challenge.ID.String(), data, ttl).Err()
+}
+
+func (r *redisLoginChallengeRepository) Find(ctx context.Context, challengeID uuid.UUID) (*models.LoginChallenge, error) {
+	data, err := r.rdb.Get(ctx, loginChallengeKeyPrefix+challengeID.String()).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, models.ErrChallengeNotFound
+		}
+		return nil, err
+	}
+
+	var challenge models.LoginChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *redisLoginChallengeRepository) Delete(ctx context.Context, challengeID uuid.UUID) error {
+	key := loginChallengeKeyPrefix + challengeID.String()
+	return r.rdb.Del(ctx, key, key+loginChallengeAttemptsKey).Err()
+}
+
+func (r *redisLoginChallengeRepository) IncrementAttempts(ctx context.Context, challengeID uuid.UUID) (int64, error) {
+	key := loginChallengeKeyPrefix + challengeID.String()
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key+loginChallengeAttemptsKey)
+	// The counter must not outlive the challenge it belongs to.
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	if d := ttl.Val(); d > 0 {
+		if err := r.rdb.Expire(ctx, key+loginChallengeAttemptsKey, d).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return incr.Val(), nil
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"chat-app/backend/repository"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	revokedTokenKeyPrefix = "revoked_jti:"
+	revokedUserKeyPrefix  = "revoked_user:"
+)
+
+type redisTokenDenyListRepository struct {
+	rdb *redis.Client
+}
+
+func NewRedisTokenDenyListRepository(rdb *redis.Client) repository.TokenDenyListRepository {
+	return &redisTokenDenyListRepository{rdb: rdb}
+}
+
+func (r *redisTokenDenyListRepository) RevokeToken(ctx context.Context, tokenID uuid.UUID, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil // Already expired
+	}
+	return r.rdb.Set(ctx, revokedTokenKeyPrefix+tokenID.String(), 1, ttl).Err()
+}
+
+func (r *redisTokenDenyListRepository) RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time, ttl time.Duration) error {
+	// "iat" has millisecond precision, so the cutoff is stored in milliseconds
+	// too. A token issued later within the same millisecond, such as the one
+	// returned by a password change, stays valid.
+	return r.rdb.Set(ctx, revokedUserKeyPrefix+userID.String(), issuedBefore.UnixMilli(), ttl).Err()
+}
+
+func (r *redisTokenDenyListRepository) IsRevoked(ctx context.Context, tokenID, userID uuid.UUID, issuedAt time.Time) (bool, error) {
+	pipe := r.rdb.Pipeline()
+	tokenCmd := pipe.Exists(ctx, revokedTokenKeyPrefix+tokenID.String())
+	userCmd := pipe.Get(ctx, revokedUserKeyPrefix+userID.String())
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+
+	if tokenCmd.Val() > 0 {
+		return true, nil
+	}
+
+	cutoff, err := userCmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cutoffMilli, err := strconv.ParseInt(cutoff, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return issuedAt.UnixMilli() < cutoffMilli, nil
+}
@@ -3,70 +3,318 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"chat-app/backend/adapter/tracing"
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	eventBufferKey = "event_buffer"
+	// Buffered events are appended to a stream and read through a consumer
+	// group, so each entry goes to one worker and stays pending until that
+	// worker acknowledges it.
+	eventStreamKey = "event_stream"
+	eventGroup     = "event_writers"
+	// eventField is the stream entry field holding the encoded event.
+	eventField = "event"
+	// Entries that can never be stored are moved to eventDeadLetterKey with
+	// the reason in deadLetterReasonField.
+	eventDeadLetterKey    = "event_dead_letter"
+	deadLetterReasonField = "reason"
+	// reclaimIdle is how long an entry may stay pending with one worker
+	// before another takes it over, assuming the first has died.
+	reclaimIdle = time.Minute
 )
 
+var tracer = tracing.Tracer("chat-app/backend/adapter/redis")
+
 type redisEventRepository struct {
 	rdb *redis.Client
+	// consumer names this process within the consumer group.
+	consumer string
+	// groupReady is set once the consumer group is known to exist.
+	groupReady atomic.Bool
+}
+
+// NewRedisEventRepository returns a repository buffering events in a Redis
+// stream. consumer must be unique among the processes flushing the buffer.
+func NewRedisEventRepository(rdb *redis.Client, consumer string) repository.EventRepository {
+	return &redisEventRepository{rdb: rdb, consumer: consumer}
 }
 
-func NewRedisEventRepository(rdb *redis.Client) repository.EventRepository {
-	return &redisEventRepository{rdb: rdb}
+// ConsumerName identifies this process in the event buffer's consumer group.
+// The process ID keeps processes sharing a host apart.
+func ConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "chat-app"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// bufferedEvent is the encoding of an event in the stream. Unlike the JSON
+// sent to clients it keeps the recipient.
+type bufferedEvent struct {
+	ID           uuid.UUID         `json:"id"`
+	Type         models.EventType  `json:"type"`
+	Payload      json.RawMessage   `json:"payload"`
+	RecipientID  uuid.UUID         `json:"recipientId"`
+	SenderID     *uuid.UUID        `json:"senderId,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 // These methods are for the Redis part of the EventRepository interface
 func (r *redisEventRepository) BufferEvent(ctx context.Context, event *models.Event) error {
-	data, err := json.Marshal(event)
+	data, err := encodeBufferedEvent(event)
 	if err != nil {
 		return err
 	}
-	// Use a sorted set, score is timestamp. This allows easy retrieval in order.
-	return r.rdb.ZAdd(ctx, eventBufferKey, &redis.Z{
-		Score:  float64(event.CreatedAt.UnixNano()),
-		Member: data,
+
+	ctx, span := tracer.Start(ctx, "redis XADD "+eventStreamKey, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "redis"),
+			attribute.String("db.operation.name", "XADD"),
+			attribute.String("event.id", event.ID.String()),
+		))
+	defer span.End()
+
+	err = r.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventStreamKey,
+		Values: map[string]interface{}{eventField: data},
 	}).Err()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
 }
 
+// GetBufferedEvents returns up to count events for this consumer: first
+// those it read before without acknowledging them, then entries abandoned by
+// workers that died before acknowledging them, then entries no worker has
+// read yet. The events stay pending until DeleteBufferedEvents acknowledges
+// them.
 func (r *redisEventRepository) GetBufferedEvents(ctx context.Context, count int) ([]*models.Event, error) {
-	results, err := r.rdb.ZRange(ctx, eventBufferKey, 0, int64(count-1)).Result()
+	if err := r.ensureGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	// "0" reads entries this consumer has read before but not acknowledged,
+	// i.e. a batch that failed, and ">" reads entries nobody has read yet.
+	messages, err := r.readGroup(ctx, "0", count)
 	if err != nil {
 		return nil, err
 	}
+	if len(messages) < count {
+		claimed, err := r.reclaim(ctx, count-len(messages))
+		if err != nil {
+			return nil, r.checkGroup(err)
+		}
+		messages = append(messages, claimed...)
+	}
+	if len(messages) < count {
+		unread, err := r.readGroup(ctx, ">", count-len(messages))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, unread...)
+	}
 
-	var events []*models.Event
-	for _, res := range results {
-		var event models.Event
-		if err := json.Unmarshal([]byte(res), &event); err == nil {
-			events = append(events, &event)
+	events := make([]*models.Event, 0, len(messages))
+	for _, msg := range messages {
+		event, err := decodeBufferedEvent(msg)
+		if err != nil {
+			// Malformed entries would otherwise be reclaimed forever.
+			slog.WarnContext(ctx, "dead-lettering malformed buffered event", "entry_id", msg.ID, "err", err)
+			if err := r.deadLetter(ctx, msg.ID, msg.Values[eventField], err.Error()); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		events = append(events, event)
 	}
 	return events, nil
 }
 
+// readGroup reads up to count entries for this consumer from id onwards.
+func (r *redisEventRepository) readGroup(ctx context.Context, id string, count int) ([]redis.XMessage, error) {
+	streams, err := r.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    eventGroup,
+		Consumer: r.consumer,
+		Streams:  []string{eventStreamKey, id},
+		Count:    int64(count),
+		Block:    -1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, r.checkGroup(err)
+	}
+	var messages []redis.XMessage
+	for _, stream := range streams {
+		messages = append(messages, stream.Messages...)
+	}
+	return messages, nil
+}
+
+// reclaim takes over up to count entries that have been pending with other
+// consumers for longer than reclaimIdle. XAUTOCLAIM would do this in one call, but its reply
+// changed in Redis 7 and the client only understands the Redis 6.2 form.
+func (r *redisEventRepository) reclaim(ctx context.Context, count int) ([]redis.XMessage, error) {
+	pending, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: eventStreamKey,
+		Group:  eventGroup,
+		Idle:   reclaimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(count),
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	// Our own pending entries are read back by GetBufferedEvents already.
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Consumer != r.consumer {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// XCLAIM checks the idle time again, so when two workers race for an
+	// entry only one gets it.
+	return r.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   eventStreamKey,
+		Group:    eventGroup,
+		Consumer: r.consumer,
+		MinIdle:  reclaimIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// DeleteBufferedEvents acknowledges and removes the stream entries of events
+// returned by GetBufferedEvents. Call it only once the events are stored.
 func (r *redisEventRepository) DeleteBufferedEvents(ctx context.Context, events []*models.Event) error {
-	if len(events) == 0 {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		if event.BufferID != "" {
+			ids = append(ids, event.BufferID)
+		}
+	}
+	return r.ack(ctx, ids)
+}
+
+// CountBufferedEvents returns how many events are waiting to be stored,
+// including those read but not yet acknowledged.
+func (r *redisEventRepository) CountBufferedEvents(ctx context.Context) (int64, error) {
+	return r.rdb.XLen(ctx, eventStreamKey).Result()
+}
+
+func (r *redisEventRepository) DeadLetterBufferedEvent(ctx context.Context, event *models.Event, reason string) error {
+	data, err := encodeBufferedEvent(event)
+	if err != nil {
+		return err
+	}
+	return r.deadLetter(ctx, event.BufferID, data, reason)
+}
+
+// deadLetter copies the entry to the dead letter stream and removes it from
+// the buffer in one transaction.
+func (r *redisEventRepository) deadLetter(ctx context.Context, id string, data interface{}, reason string) error {
+	if data == nil {
+		data = ""
+	}
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: eventDeadLetterKey,
+			Values: map[string]interface{}{eventField: data, deadLetterReasonField: reason},
+		})
+		pipe.XAck(ctx, eventStreamKey, eventGroup, id)
+		pipe.XDel(ctx, eventStreamKey, id)
+		return nil
+	})
+	return err
+}
+
+// ack acknowledges the entries and deletes them from the stream.
+func (r *redisEventRepository) ack(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
 		return nil
 	}
-	members := make([]interface{}, len(events))
-	for i, event := range events {
-		data, err := json.Marshal(event)
-		if err != nil {
-			// Log this error but continue
-			continue
-		}
-		members[i] = data
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, eventStreamKey, eventGroup, ids...)
+		pipe.XDel(ctx, eventStreamKey, ids...)
+		return nil
+	})
+	return err
+}
+
+// ensureGroup creates the stream and consumer group unless this process has
+// already seen them.
+func (r *redisEventRepository) ensureGroup(ctx context.Context) error {
+	if r.groupReady.Load() {
+		return nil
+	}
+	err := r.rdb.XGroupCreateMkStream(ctx, eventStreamKey, eventGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
 	}
-	return r.rdb.ZRem(ctx, eventBufferKey, members...).Err()
+	r.groupReady.Store(true)
+	return nil
+}
+
+// checkGroup passes err through, noting when the group has disappeared, e.g.
+// after the stream was deleted, so that the next read recreates it.
+func (r *redisEventRepository) checkGroup(err error) error {
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		r.groupReady.Store(false)
+	}
+	return err
+}
+
+func encodeBufferedEvent(event *models.Event) ([]byte, error) {
+	return json.Marshal(bufferedEvent{
+		ID:           event.ID,
+		Type:         event.Type,
+		Payload:      event.Payload,
+		RecipientID:  event.RecipientID,
+		SenderID:     event.SenderID,
+		CreatedAt:    event.CreatedAt,
+		TraceContext: event.TraceContext,
+	})
+}
+
+func decodeBufferedEvent(msg redis.XMessage) (*models.Event, error) {
+	data, ok := msg.Values[eventField].(string)
+	if !ok {
+		return nil, fmt.Errorf("entry has no %q field", eventField)
+	}
+	var be bufferedEvent
+	if err := json.Unmarshal([]byte(data), &be); err != nil {
+		return nil, err
+	}
+	return &models.Event{
+		ID:           be.ID,
+		Type:         be.Type,
+		Payload:      be.Payload,
+		RecipientID:  be.RecipientID,
+		SenderID:     be.SenderID,
+		CreatedAt:    be.CreatedAt,
+		TraceContext: be.TraceContext,
+		BufferID:     msg.ID,
+	}, nil
 }
 
 // These methods are for the Postgres part of the interface, so they are no-ops here.
@@ -82,3 +330,12 @@ func (r *redisEventRepository) Delete(ctx context.Context, eventID uuid.UUID) er
 func (r *redisEventRepository) StoreBatch(ctx context.Context, events []*models.Event) error {
 	return nil // No-op
 }
+func (r *redisEventRepository) ListMessages(ctx context.Context, userID uuid.UUID) ([]*models.Event, error) {
+	return nil, nil // No-op
+}
+func (r *redisEventRepository) DeleteTypeBefore(ctx context.Context, eventType models.EventType, cutoff time.Time, limit int) (int64, error) {
+	return 0, nil // No-op
+}
+func (r *redisEventRepository) DeleteBeforeExcept(ctx context.Context, cutoff time.Time, exceptTypes []models.EventType, limit int) (int64, error) {
+	return 0, nil // No-op
+}
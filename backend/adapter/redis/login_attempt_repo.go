@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"chat-app/backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	loginFailuresKeyPrefix = "login_failures:"
+	loginLockKeyPrefix     = "login_lock:"
+)
+
+// recordFailureScript starts the expiry window at the first failure rather
+// than sliding it forward with every attempt.
+var recordFailureScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+type redisLoginAttemptRepository struct {
+	rdb *redis.Client
+}
+
+func NewRedisLoginAttemptRepository(rdb *redis.Client) repository.LoginAttemptRepository {
+	return &redisLoginAttemptRepository{rdb: rdb}
+}
+
+func (r *redisLoginAttemptRepository) LockedFor(ctx context.Context, subject string) (time.Duration, error) {
+	ttl, err := r.rdb.PTTL(ctx, loginLockKeyPrefix+subject).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL returns a negative duration when the key does not exist.
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (r *redisLoginAttemptRepository) RecordFailure(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	return recordFailureScript.Run(ctx, r.rdb, []string{loginFailuresKeyPrefix + subject}, window.Milliseconds()).Int64()
+}
+
+func (r *redisLoginAttemptRepository) Lock(ctx context.Context, subject string, duration time.Duration) error {
+	return r.rdb.Set(ctx, loginLockKeyPrefix+subject, 1, duration).Err()
+}
+
+func (r *redisLoginAttemptRepository) Reset(ctx context.Context, subject string) error {
+	return r.rdb.Del(ctx, loginFailuresKeyPrefix+subject, loginLockKeyPrefix+subject).Err()
+}
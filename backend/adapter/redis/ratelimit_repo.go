@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	rateLimitKeyPrefix = "ratelimit:"
+)
+
+// gcraScript implements the generic cell rate algorithm. The only state is the
+// theoretical arrival time (TAT) of the next request, so each key is a single
+// string. The Redis server clock is used so replicas with skewed clocks agree.
+//
+// ARGV[1] is the emission interval and ARGV[2] the burst, both in
+// milliseconds/requests. Returns {allowed, remaining, retry_after_ms,
+// reset_after_ms}.
+var gcraScript = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + emission
+local allow_at = new_tat - emission * burst
+local diff = now - allow_at
+local remaining = math.floor(diff / emission)
+
+if remaining < 0 then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", KEYS[1], new_tat, "PX", reset_after)
+return {1, remaining, 0, reset_after}
+`)
+
+type redisRateLimitRepository struct {
+	rdb *redis.Client
+}
+
+func NewRedisRateLimitRepository(rdb *redis.Client) repository.RateLimitRepository {
+	return &redisRateLimitRepository{rdb: rdb}
+}
+
+func (r *redisRateLimitRepository) Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error) {
+	emission := policy.Period.Milliseconds() / int64(policy.Limit)
+	if emission < 1 {
+		emission = 1
+	}
+	burst := policy.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	values, err := gcraScript.Run(ctx, r.rdb, []string{rateLimitKeyPrefix + policy.Name + ":" + key}, emission, burst).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
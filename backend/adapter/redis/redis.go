@@ -1,16 +1,30 @@
 package redis
 
 import (
+	"time"
+
 	"chat-app/backend/config"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// Redis sits on the hot path of every message, so calls give up quickly
+// instead of using the client's more patient defaults.
+const (
+	dialTimeout = 2 * time.Second
+	ioTimeout   = time.Second
+	maxRetries  = 1
+)
+
 func NewRedisClient(cfg *config.Config) *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: cfg.RedisPassword,
-		DB:       0, // use default DB
+		Addr:         cfg.RedisAddr,
+		Password:     cfg.RedisPassword,
+		DB:           0, // use default DB
+		DialTimeout:  dialTimeout,
+		ReadTimeout:  ioTimeout,
+		WriteTimeout: ioTimeout,
+		MaxRetries:   maxRetries,
 	})
 	return rdb
 }
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	wsTicketKeyPrefix = "ws_ticket:"
+)
+
+type redisTicketRepository struct {
+	rdb *redis.Client
+}
+
+func NewRedisTicketRepository(rdb *redis.Client) repository.TicketRepository {
+	return &redisTicketRepository{rdb: rdb}
+}
+
+func (r *redisTicketRepository) Create(ctx context.Context, ticket *models.WsTicket, ttl time.Duration) error {
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, wsTicketKeyPrefix+ticket.ID.String(), data, ttl).Err()
+}
+
+func (r *redisTicketRepository) Consume(ctx context.Context, ticketID uuid.UUID) (*models.WsTicket, error) {
+	// GETDEL makes redemption atomic, so a ticket can never be used twice even
+	// when two upgrades race on different replicas.
+	data, err := r.rdb.GetDel(ctx, wsTicketKeyPrefix+ticketID.String()).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, models.ErrTicketNotFound
+		}
+		return nil, err
+	}
+
+	var ticket models.WsTicket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling a dependency that keeps
+// failing.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker stops calls to a failing dependency so that callers fail
+// fast instead of each waiting for it to time out. After threshold
+// consecutive failures it opens and rejects calls for cooldown, then lets a
+// single trial call through: success closes it, failure opens it again.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// NewCircuitBreaker returns a closed breaker. name identifies it in logs.
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Do calls fn unless the breaker is open, and records the outcome.
+func (b *CircuitBreaker) Do(fn func() error) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// Open reports whether the breaker is rejecting calls, apart from trials.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := b.failures >= b.threshold
+	b.trial = false
+	if err == nil {
+		if wasOpen {
+			slog.Info("circuit breaker closed", "breaker", b.name)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		if !wasOpen {
+			slog.Warn("circuit breaker opened", "breaker", b.name, "failures", b.failures, "err", err)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 10 * time.Millisecond
+	errDown := errors.New("down")
+	fail := func() error { return errDown }
+	succeed := func() error { return nil }
+
+	// Each step runs after the previous one on the same breaker; wait sleeps
+	// past the cooldown first.
+	tests := []struct {
+		name     string
+		wait     bool
+		fn       func() error
+		wantErr  error
+		wantOpen bool
+	}{
+		{"first failure passes through", false, fail, errDown, false},
+		{"success resets the count", false, succeed, nil, false},
+		{"failure below threshold", false, fail, errDown, false},
+		{"failure at threshold opens", false, fail, errDown, true},
+		{"open breaker rejects", false, succeed, ErrCircuitOpen, true},
+		{"failed trial reopens", true, fail, errDown, true},
+		{"reopened breaker rejects", false, succeed, ErrCircuitOpen, true},
+		{"successful trial closes", true, succeed, nil, false},
+		{"closed breaker calls through", false, succeed, nil, false},
+	}
+
+	b := NewCircuitBreaker("test", 2, cooldown)
+	for _, tt := range tests {
+		if tt.wait {
+			time.Sleep(2 * cooldown)
+		}
+		called := false
+		err := b.Do(func() error {
+			called = true
+			return tt.fn()
+		})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Do = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if wantCalled := tt.wantErr != ErrCircuitOpen; called != wantCalled {
+			t.Errorf("%s: fn called = %t, want %t", tt.name, called, wantCalled)
+		}
+		if got := b.Open(); got != tt.wantOpen {
+			t.Errorf("%s: Open = %t, want %t", tt.name, got, tt.wantOpen)
+		}
+	}
+}
+
+func TestCircuitBreakerAllowsOneTrial(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Millisecond)
+	_ = b.Do(func() error { return errors.New("down") })
+	time.Sleep(5 * time.Millisecond)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	if err := b.Do(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("second call during trial = %v, want ErrCircuitOpen", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("trial = %v, want nil", err)
+	}
+	if b.Open() {
+		t.Error("breaker still open after a successful trial")
+	}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+
+	"chat-app/backend/models"
+)
+
+// ValidateEmail accepts a bare address such as user@example.com.
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 254 || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return models.ErrInvalidEmail
+	}
+	return nil
+}
+
+// GenerateEmailToken returns a random URL-safe token for an emailed link.
+func GenerateEmailToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// HashEmailToken returns the stored form of an emailed token.
+func HashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
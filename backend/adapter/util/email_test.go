@@ -0,0 +1,32 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"chat-app/backend/models"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"user@example.com", true},
+		{"first.last+tag@sub.example.org", true},
+		{"", false},
+		{"user", false},
+		{"user@localhost", false},
+		{"User <user@example.com>", false},
+		{" user@example.com", false},
+	}
+	for _, tt := range tests {
+		err := ValidateEmail(tt.email)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateEmail(%q) = %v, want nil", tt.email, err)
+		}
+		if !tt.valid && !errors.Is(err, models.ErrInvalidEmail) {
+			t.Errorf("ValidateEmail(%q) = %v, want ErrInvalidEmail", tt.email, err)
+		}
+	}
+}
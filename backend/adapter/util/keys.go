@@ -0,0 +1,171 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a JWT key identified by the "kid" header of the tokens it signs.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the key used to sign new tokens and every key that is still
+// accepted for verification. Keeping the previous keys in the set lets a key
+// be rotated without invalidating tokens that are already in flight.
+type KeySet struct {
+	current *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewHMACKeySet returns a key set with a single HS256 secret.
+func NewHMACKeySet(kid, secret string) *KeySet {
+	key := &SigningKey{
+		ID:        kid,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &KeySet{current: key, keys: map[string]*SigningKey{kid: key}}
+}
+
+// LoadKeySet loads every key in dir. A file named <kid>.pem holds an RSA
+// (RS256) or Ed25519 (EdDSA) private key and a file named <kid>.key holds an
+// HMAC (HS256) secret. currentKid selects the key used for signing.
+func LoadKeySet(dir, currentKid string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".pem" && ext != ".key" {
+			continue
+		}
+		kid := strings.TrimSuffix(entry.Name(), ext)
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+		}
+
+		key, err := parseSigningKey(kid, ext, data)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys[kid] = key
+	}
+
+	current, ok := ks.keys[currentKid]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", currentKid, dir)
+	}
+	ks.current = current
+	return ks, nil
+}
+
+func parseSigningKey(kid, ext string, data []byte) (*SigningKey, error) {
+	if ext == ".key" {
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, fmt.Errorf("HMAC key %s is empty", kid)
+		}
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}, nil
+	}
+
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, signKey: rsaKey, verifyKey: &rsaKey.PublicKey}, nil
+	}
+	if edKey, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		priv, ok := edKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s is not an Ed25519 key", kid)
+		}
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, signKey: priv, verifyKey: priv.Public()}, nil
+	}
+	return nil, fmt.Errorf("key %s is neither an RSA nor an Ed25519 private key", kid)
+}
+
+// Current returns the key used to sign new tokens.
+func (ks *KeySet) Current() *SigningKey {
+	return ks.current
+}
+
+// Lookup resolves the verification key for a parsed token, enforcing that the
+// token's algorithm matches the key it names.
+func (ks *KeySet) Lookup(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served from the JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key. HMAC secrets are
+// never published.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -1,14 +1,136 @@
 package util
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms accepted by NewPasswordHasher.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies hashes produced by any supported algorithm, so the algorithm or its
+// cost can be changed without invalidating existing passwords.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash and whether
+	// the hash should be replaced because it was made with other settings.
+	Verify(password, encoded string) (ok bool, needsRehash bool)
+}
+
+type passwordHasher struct {
+	algorithm  string
+	argon      Argon2Params
+	bcryptCost int
+}
+
+func NewPasswordHasher(algorithm string, argon Argon2Params, bcryptCost int) (PasswordHasher, error) {
+	switch algorithm {
+	case PasswordHashArgon2id:
+		if argon.Memory == 0 || argon.Iterations == 0 || argon.Parallelism == 0 || argon.SaltLength == 0 || argon.KeyLength == 0 {
+			return nil, errors.New("argon2id parameters must be positive")
+		}
+	case PasswordHashBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+	return &passwordHasher{algorithm: algorithm, argon: argon, bcryptCost: bcryptCost}, nil
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.algorithm == PasswordHashBcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(bytes), err
+	}
+
+	salt := make([]byte, h.argon.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon.Iterations, h.argon.Memory, h.argon.Parallelism, h.argon.KeyLength)
+	return encodeArgon2id(h.argon, salt, key), nil
 }
 
+func (h *passwordHasher) Verify(password, encoded string) (bool, bool) {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false
+		}
+		return true, h.algorithm != PasswordHashArgon2id || params != h.argon
+	}
+
+	// Anything else is treated as bcrypt ($2a$, $2b$, $2y$).
+	if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+		return false, false
+	}
+	if h.algorithm != PasswordHashBcrypt {
+		return true, true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return true, err != nil || cost != h.bcryptCost
+}
+
+// encodeArgon2id formats a hash in the PHC string format used by the
+// reference implementation:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func encodeArgon2id(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, errors.New("malformed argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
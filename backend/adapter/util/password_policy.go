@@ -0,0 +1,83 @@
+package util
+
+import (
+	"bufio"
+	"chat-app/backend/models"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy decides whether a new password is acceptable.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// breached holds the SHA-1 digests of known breached passwords.
+	breached map[[sha1.Size]byte]struct{}
+}
+
+// NewPasswordPolicy builds a policy and, if breachedListPath is set, loads the
+// breached password list from it. Each line of the file is either a plain
+// password or a SHA-1 hex digest, optionally followed by ":<count>" as in the
+// Have I Been Pwned downloads.
+func NewPasswordPolicy(minLength, maxLength int, breachedListPath string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{MinLength: minLength, MaxLength: maxLength, breached: make(map[[sha1.Size]byte]struct{})}
+	if breachedListPath == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(breachedListPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		p.breached[breachedListKey(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return p, nil
+}
+
+func breachedListKey(line string) [sha1.Size]byte {
+	var digest [sha1.Size]byte
+	hexPart, _, _ := strings.Cut(line, ":")
+	if len(hexPart) == hex.EncodedLen(sha1.Size) {
+		if _, err := hex.Decode(digest[:], []byte(hexPart)); err == nil {
+			return digest
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// Validate returns a *models.PasswordPolicyError describing the first rule
+// the password breaks, or nil.
+func (p *PasswordPolicy) Validate(password, username string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &models.PasswordPolicyError{Reason: fmt.Sprintf("password must be at least %d characters long", p.MinLength)}
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return &models.PasswordPolicyError{Reason: fmt.Sprintf("password must be at most %d characters long", p.MaxLength)}
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &models.PasswordPolicyError{Reason: "password must not contain your username"}
+	}
+	if password != "" && strings.Count(password, password[:1]) == len(password) {
+		return &models.PasswordPolicyError{Reason: "password must not be a single repeated character"}
+	}
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return &models.PasswordPolicyError{Reason: "password has appeared in a data breach, choose a different one"}
+	}
+	return nil
+}
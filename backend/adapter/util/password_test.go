@@ -0,0 +1,130 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; the encoding does not depend on them.
+var testArgon = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func mustHasher(t *testing.T, algorithm string, argon Argon2Params, bcryptCost int) PasswordHasher {
+	t.Helper()
+	h, err := NewPasswordHasher(algorithm, argon, bcryptCost)
+	if err != nil {
+		t.Fatalf("NewPasswordHasher(%q): %v", algorithm, err)
+	}
+	return h
+}
+
+func mustHash(t *testing.T, h PasswordHasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return encoded
+}
+
+func TestNewPasswordHasherRejectsBadSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  string
+		argon      Argon2Params
+		bcryptCost int
+	}{
+		{"unknown algorithm", "md5", testArgon, bcrypt.MinCost},
+		{"zero argon2 memory", PasswordHashArgon2id, Argon2Params{Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, 0},
+		{"bcrypt cost too low", PasswordHashBcrypt, testArgon, bcrypt.MinCost - 1},
+		{"bcrypt cost too high", PasswordHashBcrypt, testArgon, bcrypt.MaxCost + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPasswordHasher(tt.algorithm, tt.argon, tt.bcryptCost); err == nil {
+				t.Error("NewPasswordHasher succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestArgon2idEncodeDecode(t *testing.T) {
+	h := mustHasher(t, PasswordHashArgon2id, testArgon, 0)
+	encoded := mustHash(t, h, "correct horse")
+
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash = %q, want the PHC argon2id format", encoded)
+	}
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatalf("decodeArgon2id: %v", err)
+	}
+	if params != testArgon {
+		t.Errorf("decoded params = %+v, want %+v", params, testArgon)
+	}
+	if got := encodeArgon2id(params, salt, key); got != encoded {
+		t.Errorf("re-encoded = %q, want %q", got, encoded)
+	}
+}
+
+func TestDecodeArgon2idRejectsMalformedHashes(t *testing.T) {
+	tests := []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+	}
+	for _, encoded := range tests {
+		if _, _, _, err := decodeArgon2id(encoded); err == nil {
+			t.Errorf("decodeArgon2id(%q) succeeded, want an error", encoded)
+		}
+	}
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	argon := mustHasher(t, PasswordHashArgon2id, testArgon, 0)
+	stronger := testArgon
+	stronger.Iterations = 2
+	strongerArgon := mustHasher(t, PasswordHashArgon2id, stronger, 0)
+	bcryptHasher := mustHasher(t, PasswordHashBcrypt, testArgon, bcrypt.MinCost)
+	costlierBcrypt := mustHasher(t, PasswordHashBcrypt, testArgon, bcrypt.MinCost+1)
+
+	argonHash := mustHash(t, argon, "secret")
+	bcryptHash := mustHash(t, bcryptHasher, "secret")
+
+	tests := []struct {
+		name            string
+		hasher          PasswordHasher
+		password        string
+		encoded         string
+		wantOK          bool
+		wantNeedsRehash bool
+	}{
+		{"argon2id match", argon, "secret", argonHash, true, false},
+		{"argon2id mismatch", argon, "wrong", argonHash, false, false},
+		{"argon2id with outdated parameters", strongerArgon, "secret", argonHash, true, true},
+		{"argon2id read by bcrypt hasher", bcryptHasher, "secret", argonHash, true, true},
+		{"bcrypt match", bcryptHasher, "secret", bcryptHash, true, false},
+		{"bcrypt mismatch", bcryptHasher, "wrong", bcryptHash, false, false},
+		{"bcrypt with outdated cost", costlierBcrypt, "secret", bcryptHash, true, true},
+		{"bcrypt read by argon2id hasher", argon, "secret", bcryptHash, true, true},
+		{"malformed argon2id", argon, "secret", "$argon2id$garbage", false, false},
+		{"garbage", argon, "secret", "not a hash", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := tt.hasher.Verify(tt.password, tt.encoded)
+			if ok != tt.wantOK || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("Verify = (%t, %t), want (%t, %t)", ok, needsRehash, tt.wantOK, tt.wantNeedsRehash)
+			}
+		})
+	}
+}
+
+func TestHashUsesFreshSalt(t *testing.T) {
+	h := mustHasher(t, PasswordHashArgon2id, testArgon, 0)
+	if mustHash(t, h, "secret") == mustHash(t, h, "secret") {
+		t.Error("two hashes of the same password are equal")
+	}
+}
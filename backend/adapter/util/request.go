@@ -0,0 +1,51 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the peer that sent the request. Behind
+// a reverse proxy, middleware.RealIP must run first so that RemoteAddr holds
+// the original client rather than the proxy.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Fallback for environments without a port
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// ParseCIDRs parses a list of CIDR ranges. Bare IP addresses are accepted and
+// treated as single-host ranges.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
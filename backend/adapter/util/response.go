@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 )
 
@@ -9,6 +10,13 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 	RespondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// RespondWithInternalError logs err against the request and answers with a
+// generic 500, keeping the cause out of the response.
+func RespondWithInternalError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	slog.ErrorContext(r.Context(), message, "err", err)
+	RespondWithError(w, http.StatusInternalServerError, message)
+}
+
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")
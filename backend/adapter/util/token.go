@@ -1,40 +1,137 @@
 package util
 
 import (
+	"chat-app/backend/models"
+	"encoding/json"
+	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	UserID  uuid.UUID
+	TokenID uuid.UUID
+	// SessionID is the refresh token family the access token was issued
+	// under. It is uuid.Nil for tokens minted before the claim existed.
+	SessionID uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
 type TokenGenerator interface {
-	GenerateAccessToken(userID uuid.UUID) (string, error)
+	GenerateAccessToken(userID, sessionID uuid.UUID) (string, error)
+	ParseAccessToken(tokenString string) (*AccessClaims, error)
 	GenerateRefreshToken() (uuid.UUID, time.Time, error)
+	GetAccessTokenExp() time.Duration
 	GetRefreshTokenExp() time.Duration
+	JWKS() JWKSet
 }
 
 type tokenGenerator struct {
-	jwtSecret       string
+	keys            *KeySet
 	accessTokenExp  time.Duration
 	refreshTokenExp time.Duration
 }
 
-func NewTokenGenerator(secret string, accessExp, refreshExp time.Duration) TokenGenerator {
+func NewTokenGenerator(keys *KeySet, accessExp, refreshExp time.Duration) TokenGenerator {
 	return &tokenGenerator{
-		jwtSecret:       secret,
+		keys:            keys,
 		accessTokenExp:  accessExp,
 		refreshTokenExp: refreshExp,
 	}
 }
 
-func (t *tokenGenerator) GenerateAccessToken(userID uuid.UUID) (string, error) {
+func (t *tokenGenerator) GenerateAccessToken(userID, sessionID uuid.UUID) (string, error) {
+	key := t.keys.Current()
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID.String(),
-		"exp":     time.Now().Add(t.accessTokenExp).Unix(),
-		"iat":     time.Now().Unix(),
+		"sid":     sessionID.String(),
+		"jti":     uuid.New().String(),
+		"exp":     now.Add(t.accessTokenExp).Unix(),
+		// Fractional seconds, so that revoking a user's tokens also catches
+		// those issued earlier within the same second.
+		"iat": float64(now.UnixMilli()) / 1000,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(t.jwtSecret))
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+func (t *tokenGenerator) ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	token, err := jwt.Parse(tokenString, t.keys.Lookup)
+	if err != nil || !token.Valid {
+		return nil, models.ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+
+	userIDStr, ok := claims["user_id"].(string)
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, models.ErrInvalidToken
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+	tokenID, err := uuid.Parse(jti)
+	if err != nil {
+		return nil, models.ErrInvalidToken
+	}
+
+	var sessionID uuid.UUID
+	if sid, ok := claims["sid"].(string); ok {
+		if sessionID, err = uuid.Parse(sid); err != nil {
+			return nil, models.ErrInvalidToken
+		}
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, models.ErrInvalidToken
+	}
+	iat, ok := issuedAt(claims)
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+
+	return &AccessClaims{
+		UserID:    userID,
+		TokenID:   tokenID,
+		SessionID: sessionID,
+		IssuedAt:  iat,
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+// issuedAt reads "iat" to the millisecond; MapClaims.GetIssuedAt truncates it
+// to whole seconds.
+func issuedAt(claims jwt.MapClaims) (time.Time, bool) {
+	var seconds float64
+	switch v := claims["iat"].(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	default:
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(math.Round(seconds * 1000))), true
 }
 
 func (t *tokenGenerator) GenerateRefreshToken() (uuid.UUID, time.Time, error) {
@@ -43,7 +140,14 @@ func (t *tokenGenerator) GenerateRefreshToken() (uuid.UUID, time.Time, error) {
 	return refreshToken, expiresAt, nil
 }
 
+func (t *tokenGenerator) GetAccessTokenExp() time.Duration {
+	return t.accessTokenExp
+}
+
 func (t *tokenGenerator) GetRefreshTokenExp() time.Duration {
 	return t.refreshTokenExp
 }
 
+func (t *tokenGenerator) JWKS() JWKSet {
+	return t.keys.JWKS()
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAccessTokenIssuedAtKeepsMilliseconds(t *testing.T) {
+	gen := NewTokenGenerator(NewHMACKeySet("test", "secret"), time.Minute, time.Hour)
+	userID, sessionID := uuid.New(), uuid.New()
+
+	before := time.Now().Truncate(time.Millisecond)
+	token, err := gen.GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	after := time.Now()
+
+	claims, err := gen.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	if claims.UserID != userID || claims.SessionID != sessionID {
+		t.Errorf("claims = %+v, want user %s and session %s", claims, userID, sessionID)
+	}
+	if claims.IssuedAt.Before(before) || claims.IssuedAt.After(after) {
+		t.Errorf("IssuedAt = %s, want between %s and %s", claims.IssuedAt, before, after)
+	}
+}
+
+func TestParseAccessTokenRejectsForeignSignature(t *testing.T) {
+	issuer := NewTokenGenerator(NewHMACKeySet("test", "secret"), time.Minute, time.Hour)
+	verifier := NewTokenGenerator(NewHMACKeySet("test", "other secret"), time.Minute, time.Hour)
+
+	token, err := issuer.GenerateAccessToken(uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := verifier.ParseAccessToken(token); err == nil {
+		t.Error("ParseAccessToken accepted a token signed with another key")
+	}
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The RFC lists eight-digit codes; six-digit codes are their last six
+	// digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		wantOK bool
+		step   int64
+	}{
+		{"current step", rfc6238Secret, totpCode(key, current), true, current},
+		{"previous step", rfc6238Secret, totpCode(key, current-1), true, current - 1},
+		{"next step", rfc6238Secret, totpCode(key, current+1), true, current + 1},
+		{"two steps old", rfc6238Secret, totpCode(key, current-2), false, 0},
+		{"two steps ahead", rfc6238Secret, totpCode(key, current+2), false, 0},
+		{"lower case secret", strings.ToLower(rfc6238Secret), totpCode(key, current), true, current},
+		{"wrong length", rfc6238Secret, "12345", false, 0},
+		{"invalid secret", "not base32!", totpCode(key, current), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.step {
+				t.Errorf("ValidateTOTP = (%d, %t), want (%d, %t)", step, ok, tt.step, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("recovery code %q, want xxxxx-xxxxx", code)
+		}
+		variants := []string{strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), " " + code + " "}
+		for _, v := range variants {
+			if HashRecoveryCode(v) != HashRecoveryCode(code) {
+				t.Errorf("HashRecoveryCode(%q) differs from HashRecoveryCode(%q)", v, code)
+			}
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package util
 
 import (
+	"chat-app/backend/models"
 	"errors"
 	"mime/multipart"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -14,7 +17,7 @@ var (
 
 func ValidateUsername(username string) error {
 	if !usernameRegex.MatchString(username) {
-		return errors.New("username must be 4-50 characters and contain only lowercase letters, digits, and underscores")
+		return &models.ProfileValidationError{Reason: "username must be 4-50 characters and contain only lowercase letters, digits, and underscores"}
 	}
 	return nil
 }
@@ -33,17 +36,49 @@ func ValidateGroupHandle(handle string) error {
 	return nil
 }
 
-func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters long")
+// ValidateDisplayName accepts any printable Unicode up to 64 characters.
+func ValidateDisplayName(name string) error {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > 64 || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return &models.ProfileValidationError{Reason: "display name must be at most 64 characters with no control characters"}
 	}
 	return nil
 }
 
+func ValidateBio(bio string) error {
+	// Line breaks are allowed in a bio; other control characters are not.
+	invalid := func(r rune) bool { return unicode.IsControl(r) && r != '\n' }
+	if !utf8.ValidString(bio) || utf8.RuneCountInString(bio) > 500 || strings.IndexFunc(bio, invalid) >= 0 {
+		return &models.ProfileValidationError{Reason: "bio must be at most 500 characters"}
+	}
+	return nil
+}
+
+func ValidateStatus(text, emoji string) error {
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > 100 || strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return &models.ProfileValidationError{Reason: "status text must be at most 100 characters"}
+	}
+	// An emoji may be a sequence of several code points (skin tones, ZWJ
+	// sequences, flags) but never contains letters or whitespace.
+	notEmoji := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.IsControl(r) }
+	if !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > 16 || strings.IndexFunc(emoji, notEmoji) >= 0 {
+		return &models.ProfileValidationError{Reason: "status emoji must be a single emoji"}
+	}
+	return nil
+}
+
+func ValidateLastSeenVisibility(v models.LastSeenVisibility) error {
+	switch v {
+	case models.LastSeenEveryone, models.LastSeenFriends, models.LastSeenNobody:
+		return nil
+	default:
+		return &models.ProfileValidationError{Reason: "last seen visibility must be everyone, friends or nobody"}
+	}
+}
+
 func ValidateProfilePic(header *multipart.FileHeader) error {
 	// Max size: 200 KB
 	if header.Size > 200*1024 {
-		return errors.New("profile picture size cannot exceed 200 KB")
+		return &models.ProfileValidationError{Reason: "profile picture size cannot exceed 200 KB"}
 	}
 
 	// Allowed formats: png, jpg, jpeg, webp
@@ -52,7 +87,7 @@ func ValidateProfilePic(header *multipart.FileHeader) error {
 	case "image/png", "image/jpeg", "image/webp":
 		return nil
 	default:
-		return errors.New("invalid file format. Only png, jpg, jpeg, and webp are allowed")
+		return &models.ProfileValidationError{Reason: "invalid file format. Only png, jpg, jpeg, and webp are allowed"}
 	}
 }
 
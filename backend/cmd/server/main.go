@@ -2,29 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"chat-app/backend/adapter/filesystem"
 	httpHandler "chat-app/backend/adapter/handler/http"
 	"chat-app/backend/adapter/handler/ws"
+	"chat-app/backend/adapter/health"
+	"chat-app/backend/adapter/mailer"
+	"chat-app/backend/adapter/metrics"
 	"chat-app/backend/adapter/middleware"
 	"chat-app/backend/adapter/postgres"
 	"chat-app/backend/adapter/redis"
+	"chat-app/backend/adapter/tracing"
 	"chat-app/backend/adapter/util"
 	"chat-app/backend/config"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
 	"chat-app/backend/usecase"
+	"chat-app/backend/worker"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 )
 
 func fileServer(r chi.Router, path string, root http.FileSystem) {
@@ -48,18 +58,33 @@ func fileServer(r chi.Router, path string, root http.FileSystem) {
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		fatal("failed to load config", err)
+	}
+
+	logger, err := util.NewLogger(os.Stdout, cfg.LogLevel)
+	if err != nil {
+		fatal("invalid LOG_LEVEL", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Settings{
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", err)
 	}
 
 	db, err := postgres.NewDB(cfg)
 	if err != nil {
-		log.Fatalf("failed to connect to postgres: %v", err)
+		fatal("failed to connect to postgres", err)
 	}
 	defer db.Close()
+	metrics.RegisterDB(db, "postgres")
 
 	rdb := redis.NewRedisClient(cfg)
 	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
-		log.Fatalf("failed to connect to redis: %v", err)
+		fatal("failed to connect to redis", err)
 	}
 	defer rdb.Close()
 
@@ -69,105 +94,239 @@ func main() {
 	friendRepo := postgres.NewPostgresFriendshipRepository(db)
 	groupRepo := postgres.NewPostgresGroupRepository(db)
 	fileRepo := filesystem.NewLocalStorage(cfg.ProfilePicDir, cfg.ProfilePicRoute)
-	redisEventRepo := redis.NewRedisEventRepository(rdb)
+	ticketRepo := redis.NewRedisTicketRepository(rdb)
+	denyListRepo := redis.NewRedisTokenDenyListRepository(rdb)
+	challengeRepo := redis.NewRedisLoginChallengeRepository(rdb)
+	loginAttemptRepo := redis.NewRedisLoginAttemptRepository(rdb)
+	rateLimitRepo := redis.NewRedisRateLimitRepository(rdb)
+	recoveryCodeRepo := postgres.NewPostgresRecoveryCodeRepository(db)
+	emailTokenRepo := postgres.NewPostgresEmailTokenRepository(db)
+	blockRepo := postgres.NewPostgresBlockRepository(db)
+	messageSearchRepo := postgres.NewPostgresMessageSearchRepository(db)
+	redisEventRepo := redis.NewRedisEventRepository(rdb, redis.ConsumerName())
 	dbEventRepo := postgres.NewPostgresEventRepository(db)
 
 	// Utilities
-	tokenGen := util.NewTokenGenerator(cfg.JWTSecret, cfg.AccessTokenExp, cfg.RefreshTokenExp)
+	// Without a key directory we fall back to a single HS256 key from JWT_SECRET.
+	keySet := util.NewHMACKeySet(cfg.JWTSigningKeyID, cfg.JWTSecret)
+	if cfg.JWTKeysDir != "" {
+		keySet, err = util.LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+		if err != nil {
+			fatal("failed to load JWT keys", err)
+		}
+	}
+	tokenGen := util.NewTokenGenerator(keySet, cfg.AccessTokenExp, cfg.RefreshTokenExp)
+
+	passwordHasher, err := util.NewPasswordHasher(cfg.PasswordHashAlgorithm, util.Argon2Params{
+		Memory:      cfg.Argon2MemoryKB,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}, cfg.BcryptCost)
+	if err != nil {
+		fatal("failed to set up password hashing", err)
+	}
+	passwordPolicy, err := util.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordMaxLength, cfg.BreachedPasswordsFile)
+	if err != nil {
+		fatal("failed to load password policy", err)
+	}
+
+	var mail repository.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		mail, err = mailer.NewFileMailer(cfg.MailFileDir, cfg.MailFrom)
+		if err != nil {
+			fatal("failed to set up file mailer", err)
+		}
+	case "log":
+		mail = mailer.NewLogMailer(cfg.MailFrom)
+	default:
+		fatal("invalid MAILER", fmt.Errorf("unknown mailer %q", cfg.Mailer))
+	}
 
 	// Usecases
-	eventUsecase := usecase.NewEventUsecase(redisEventRepo, dbEventRepo)
-	authUsecase := usecase.NewAuthUsecase(userRepo, sessionRepo, tokenGen)
-	userUsecase := usecase.NewUserUsecase(userRepo, fileRepo)
-	friendUsecase := usecase.NewFriendUsecase(userRepo, friendRepo, eventUsecase)
+	eventBufferBreaker := util.NewCircuitBreaker("event_buffer", cfg.EventBufferBreakerThreshold, cfg.EventBufferBreakerCooldown)
+	metrics.RegisterCircuitBreaker("event_buffer", eventBufferBreaker.Open)
+	eventUsecase, err := usecase.NewEventUsecase(redisEventRepo, dbEventRepo, cfg.EventDurability, eventBufferBreaker)
+	if err != nil {
+		fatal("invalid EVENT_DURABILITY", err)
+	}
+	twoFactorUsecase := usecase.NewTwoFactorUsecase(userRepo, recoveryCodeRepo, cfg.TOTPIssuer)
+	lockoutPolicy := usecase.LockoutPolicy{
+		MaxUserFailures: cfg.LoginMaxUserFailures,
+		MaxIPFailures:   cfg.LoginMaxIPFailures,
+		FailureWindow:   cfg.LoginFailureWindow,
+		BaseLockout:     cfg.LoginLockoutBase,
+		MaxLockout:      cfg.LoginLockoutMax,
+	}
+	authUsecase := usecase.NewAuthUsecase(userRepo, sessionRepo, ticketRepo, denyListRepo, challengeRepo, loginAttemptRepo, tokenGen, passwordHasher, passwordPolicy, eventUsecase, twoFactorUsecase, lockoutPolicy, cfg.WsTicketTTL)
+	friendUsecase := usecase.NewFriendUsecase(userRepo, friendRepo, blockRepo, eventUsecase)
 	groupUsecase := usecase.NewGroupUsecase(groupRepo, userRepo, friendRepo, fileRepo, eventUsecase)
+	emailUsecase := usecase.NewEmailUsecase(userRepo, emailTokenRepo, sessionRepo, mail, passwordHasher, passwordPolicy, authUsecase, eventUsecase, usecase.EmailSettings{
+		BaseURL:         cfg.AppBaseURL,
+		VerificationTTL: cfg.EmailVerificationTTL,
+		ResetTTL:        cfg.PasswordResetTTL,
+	})
+	searchUsecase := usecase.NewSearchUsecase(messageSearchRepo)
+	userUsecase := usecase.NewUserUsecase(userRepo, friendRepo, groupRepo, fileRepo, passwordHasher, passwordPolicy, authUsecase, groupUsecase, eventUsecase)
 
 	// Handlers
-	authHandler := httpHandler.NewAuthHandler(authUsecase)
+	authHandler := httpHandler.NewAuthHandler(authUsecase, httpHandler.CookieOptions{
+		RefreshTokenCookie: cfg.RefreshTokenCookie,
+		Secure:             cfg.CookieSecure,
+		MaxAge:             cfg.RefreshTokenExp,
+	})
 	userHandler := httpHandler.NewUserHandler(userUsecase)
+	twoFactorHandler := httpHandler.NewTwoFactorHandler(twoFactorUsecase, authUsecase)
+	emailHandler := httpHandler.NewEmailHandler(emailUsecase)
+	searchHandler := httpHandler.NewSearchHandler(searchUsecase)
 	friendHandler := httpHandler.NewFriendHandler(friendUsecase)
 	groupHandler := httpHandler.NewGroupHandler(groupUsecase)
 	webHandler := httpHandler.NewWebHandler("./web/templates")
 
 	// WebSocket Hub
-	hub := ws.NewHub(eventUsecase, groupUsecase)
+	frameRate := rate.Limit(cfg.WsFrameRate)
+	if frameRate <= 0 {
+		frameRate = rate.Inf
+	}
+	rateLimitBreaker := util.NewCircuitBreaker("rate_limit", cfg.RateLimitBreakerThreshold, cfg.RateLimitBreakerCooldown)
+	metrics.RegisterCircuitBreaker("rate_limit", rateLimitBreaker.Open)
+	hub := ws.NewHub(eventUsecase, groupUsecase, authUsecase, userUsecase, rateLimitRepo, rateLimitBreaker, ws.FloodControl{
+		FrameRate:    frameRate,
+		FrameBurst:   cfg.WsFrameBurst,
+		UserMessages: rateLimitPolicy("ws_messages", cfg.RateLimitWsMessages),
+	})
 	go hub.Run()
 
-	// Background worker for event persistence
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				events, err := redisEventRepo.GetBufferedEvents(ctx, 100)
-				if err != nil {
-					log.Printf("error getting buffered events: %v", err)
-					cancel()
-					continue
-				}
-				if len(events) > 0 {
-					if err := dbEventRepo.StoreBatch(ctx, events); err != nil {
-						log.Printf("error storing event batch to db: %v", err)
-					} else {
-						if err := redisEventRepo.DeleteBufferedEvents(ctx, events); err != nil {
-							log.Printf("error deleting buffered events from redis: %v", err)
-						}
-					}
-				}
-				cancel()
-			}
-		}
-	}()
+	// Background workers for event persistence and cleanup, unless
+	// cmd/worker runs them
+	persister := worker.NewPersister(redisEventRepo, dbEventRepo, worker.Settings{
+		Interval:   cfg.EventFlushInterval,
+		BatchSize:  cfg.EventFlushBatchSize,
+		MaxBackoff: cfg.EventFlushMaxBackoff,
+	})
+	retention, err := worker.ParseRetention(cfg.EventRetention, cfg.EventRetentionDefaultDays)
+	if err != nil {
+		fatal("invalid EVENT_RETENTION_DAYS", err)
+	}
+	janitor := worker.NewJanitor(dbEventRepo, sessionRepo, postgres.NewPostgresEventPartitionRepository(db), worker.JanitorSettings{
+		Interval:    cfg.JanitorInterval,
+		BatchSize:   cfg.JanitorBatchSize,
+		Retention:   retention,
+		Partitioned: cfg.EventPartitioning,
+	})
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	if cfg.EventWorkerEnabled {
+		workers.Add(2)
+		go func() {
+			defer workers.Done()
+			persister.Run(workerCtx)
+		}()
+		go func() {
+			defer workers.Done()
+			janitor.Run(workerCtx)
+		}()
+	}
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	checker.Register("postgres", db.PingContext)
+	checker.Register("redis", func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
+	if cfg.EventWorkerEnabled {
+		checker.Register("eventWorker", persister.Check)
+	}
+	checker.Register("hub", hub.Ping)
+	healthHandler := httpHandler.NewHealthHandler(checker)
+
+	trustedProxies, err := util.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		fatal("invalid TRUSTED_PROXIES", err)
+	}
+
+	rateLimiter := middleware.NewRateLimiter(rateLimitRepo)
+	defaultLimit := rateLimiter.Limit(rateLimitPolicy("default", cfg.RateLimitDefault))
+	loginLimit := rateLimiter.Limit(rateLimitPolicy("login", cfg.RateLimitLogin))
+	registerLimit := rateLimiter.Limit(rateLimitPolicy("register", cfg.RateLimitRegister))
+	searchLimit := rateLimiter.Limit(rateLimitPolicy("search", cfg.RateLimitSearch))
 
 	router := chi.NewRouter()
-	router.Use(chiMiddleware.Recoverer)
+	router.Use(chiMiddleware.RequestID)
+	router.Use(middleware.RealIP(trustedProxies))
+	router.Use(middleware.Tracing)
 	router.Use(middleware.Logging)
+	router.Use(middleware.Metrics)
+	router.Use(chiMiddleware.Recoverer)
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://*", "https://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Traceparent", "Tracestate"},
+		ExposedHeaders:   []string{"Link", middleware.RequestIDHeader, "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Health and Metrics endpoints
-	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	router.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		metrics := struct {
-			ConnectedClients int `json:"connected_clients"`
-		}{
-			ConnectedClients: hub.GetClientCount(),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(metrics)
-	})
+	router.Get("/livez", healthHandler.Livez)
+	router.Get("/health", healthHandler.Livez) // Kept for existing probes
+	router.Get("/readyz", healthHandler.Readyz)
+	router.Get("/metrics", promhttp.Handler().ServeHTTP)
+
+	// Public keys for verifying access tokens
+	router.Get("/.well-known/jwks.json", authHandler.JWKS)
 
 	// Public API routes
 	router.Group(func(r chi.Router) {
-		r.Use(middleware.RateLimit)
-		r.Post("/api/v1/register", userHandler.Register)
-		r.Post("/api/v1/login", authHandler.Login)
-		r.Post("/api/v1/refresh", authHandler.Refresh)
+		r.With(registerLimit).Post("/api/v1/register", userHandler.Register)
+		r.With(loginLimit).Post("/api/v1/login", authHandler.Login)
+		r.With(loginLimit).Post("/api/v1/login/2fa", authHandler.LoginTwoFactor)
+		r.With(loginLimit).Post("/api/v1/password/forgot", emailHandler.ForgotPassword)
+		r.With(loginLimit).Post("/api/v1/password/reset", emailHandler.ResetPassword)
+		r.With(loginLimit).Post("/api/v1/email/verify", emailHandler.VerifyEmail)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(defaultLimit)
 		r.Post("/api/v1/logout", authHandler.Logout)
+
+		// Routes that accept the refresh token cookie need CSRF protection.
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.CSRF(httpHandler.RefreshTokenCookieName))
+			r.Post("/api/v1/refresh", authHandler.Refresh)
+			r.Delete("/api/v1/refresh", authHandler.Logout)
+		})
+
+		// WebSocket route. Authenticates itself via ticket, header or first frame.
+		r.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
+			ws.ServeWs(hub, w, r)
+		})
 	})
 
 	// Protected API routes
-	authMiddleware := middleware.NewAuthMiddleware(cfg.JWTSecret)
+	authMiddleware := middleware.NewAuthMiddleware(authUsecase)
 	router.Group(func(r chi.Router) {
 		r.Use(authMiddleware.Validate)
-		r.Use(middleware.RateLimit)
+		r.Use(defaultLimit)
 
 		// User routes
+		r.With(searchLimit).Get("/api/v1/users/search", userHandler.SearchUsers)
 		r.Get("/api/v1/users/{username}", userHandler.GetUserByUsername)
 		r.Put("/api/v1/me", userHandler.UpdateProfile)
+		r.Put("/api/v1/me/status", userHandler.SetStatus)
+		r.Delete("/api/v1/me/status", userHandler.ClearStatus)
+		r.Delete("/api/v1/me", userHandler.DeleteAccount)
+		r.Get("/api/v1/me/export", userHandler.ExportData)
+		r.Post("/api/v1/me/password", authHandler.ChangePassword)
+		r.Put("/api/v1/me/email", emailHandler.SetEmail)
+
+		// Two-factor authentication routes
+		r.Post("/api/v1/me/2fa/enroll", twoFactorHandler.BeginEnrollment)
+		r.Post("/api/v1/me/2fa/confirm", twoFactorHandler.ConfirmEnrollment)
+		r.Post("/api/v1/me/2fa/disable", twoFactorHandler.Disable)
 
 		// Friend routes
 		r.Post("/api/v1/friends/requests", friendHandler.SendRequest)
@@ -175,19 +334,29 @@ func main() {
 		r.Delete("/api/v1/friends/{friendID}", friendHandler.Unfriend)
 		r.Get("/api/v1/friends", friendHandler.ListFriends)
 		r.Get("/api/v1/friends/requests/pending", friendHandler.ListPendingRequests)
+		r.Get("/api/v1/friends/suggestions", friendHandler.SuggestFriends)
+		r.Get("/api/v1/blocks", friendHandler.ListBlocked)
+		r.Post("/api/v1/blocks", friendHandler.BlockUser)
+		r.Delete("/api/v1/blocks/{userID}", friendHandler.UnblockUser)
 
 		// Group routes
 		r.Post("/api/v1/groups", groupHandler.CreateGroup)
 		r.Post("/api/v1/groups/join", groupHandler.JoinGroup)
 		r.Post("/api/v1/groups/{groupID}/leave", groupHandler.LeaveGroup)
+		r.Put("/api/v1/groups/{groupID}/slow-mode", groupHandler.SetSlowMode)
+		r.Put("/api/v1/groups/{groupID}/privacy", groupHandler.SetPrivate)
 		r.Post("/api/v1/groups/{groupID}/members", groupHandler.AddMember)
 		r.Delete("/api/v1/groups/{groupID}/members/{memberID}", groupHandler.RemoveMember)
-		r.Get("/api/v1/groups/search", groupHandler.SearchGroups)
+		r.With(searchLimit).Get("/api/v1/groups/search", groupHandler.SearchGroups)
 
-		// WebSocket route
-		r.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
-			ws.ServeWs(hub, w, r)
-		})
+		// Search
+		r.With(searchLimit).Get("/api/v1/search/messages", searchHandler.SearchMessages)
+
+		// WebSocket ticket
+		r.Post("/api/v1/ws/ticket", authHandler.IssueWsTicket)
+
+		// Admin routes
+		r.Post("/api/v1/admin/users/{username}/unlock", authHandler.UnlockAccount)
 	})
 
 	// Serve static files
@@ -204,9 +373,9 @@ func main() {
 	}
 
 	go func() {
-		log.Printf("Server starting on port %s", cfg.ServerPort)
+		slog.Info("server starting", "port", cfg.ServerPort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+			fatal("listen failed", err)
 		}
 	}()
 
@@ -214,13 +383,54 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Fail readiness first and keep serving for a while, so load balancers
+	// take this instance out of rotation before the listener closes.
+	checker.SetDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
+
+	// Tell WebSocket clients to reconnect elsewhere before closing the
+	// listener; hijacked connections are not tracked by srv.Shutdown.
+	if err := hub.Shutdown(ctx); err != nil {
+		slog.Error("websocket connections forced closed", "err", err)
+	}
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		slog.Error("server forced to shut down", "err", err)
+	}
+
+	// Nothing produces events any more. Stop the workers and move whatever
+	// is still buffered to Postgres.
+	stopWorker()
+	workers.Wait()
+	if cfg.EventWorkerEnabled {
+		if err := persister.Drain(ctx); err != nil {
+			slog.Error("failed to flush buffered events", "err", err)
+		}
 	}
 
-	log.Println("Server exiting")
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush spans", "err", err)
+	}
+
+	slog.Info("server exiting")
+}
+
+func rateLimitPolicy(name string, rl config.RateLimit) models.RateLimitPolicy {
+	return models.RateLimitPolicy{
+		Name:   name,
+		Limit:  rl.PerMinute,
+		Period: time.Minute,
+		Burst:  rl.Burst,
+	}
+}
+
+// fatal logs err and exits, in place of log.Fatalf now that logs go through
+// slog.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
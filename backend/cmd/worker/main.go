@@ -0,0 +1,151 @@
+// Command worker runs the event persistence worker and the janitor on their
+// own, so that they can be scaled apart from the API servers. Run the
+// servers with EVENT_WORKER_ENABLED=false alongside it.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	httpHandler "chat-app/backend/adapter/handler/http"
+	"chat-app/backend/adapter/health"
+	"chat-app/backend/adapter/metrics"
+	"chat-app/backend/adapter/postgres"
+	"chat-app/backend/adapter/redis"
+	"chat-app/backend/adapter/tracing"
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/config"
+	"chat-app/backend/worker"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("failed to load config", err)
+	}
+
+	logger, err := util.NewLogger(os.Stdout, cfg.LogLevel)
+	if err != nil {
+		fatal("invalid LOG_LEVEL", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Settings{
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	db, err := postgres.NewDB(cfg)
+	if err != nil {
+		fatal("failed to connect to postgres", err)
+	}
+	defer db.Close()
+	metrics.RegisterDB(db, "postgres")
+
+	rdb := redis.NewRedisClient(cfg)
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		fatal("failed to connect to redis", err)
+	}
+	defer rdb.Close()
+
+	dbEventRepo := postgres.NewPostgresEventRepository(db)
+	persister := worker.NewPersister(
+		redis.NewRedisEventRepository(rdb, redis.ConsumerName()),
+		dbEventRepo,
+		worker.Settings{
+			Interval:   cfg.EventFlushInterval,
+			BatchSize:  cfg.EventFlushBatchSize,
+			MaxBackoff: cfg.EventFlushMaxBackoff,
+		})
+
+	retention, err := worker.ParseRetention(cfg.EventRetention, cfg.EventRetentionDefaultDays)
+	if err != nil {
+		fatal("invalid EVENT_RETENTION_DAYS", err)
+	}
+	janitor := worker.NewJanitor(
+		dbEventRepo,
+		postgres.NewPostgresSessionRepository(db),
+		postgres.NewPostgresEventPartitionRepository(db),
+		worker.JanitorSettings{
+			Interval:    cfg.JanitorInterval,
+			BatchSize:   cfg.JanitorBatchSize,
+			Retention:   retention,
+			Partitioned: cfg.EventPartitioning,
+		})
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	checker.Register("postgres", db.PingContext)
+	checker.Register("redis", func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
+	checker.Register("eventWorker", persister.Check)
+	healthHandler := httpHandler.NewHealthHandler(checker)
+
+	router := chi.NewRouter()
+	router.Get("/livez", healthHandler.Livez)
+	router.Get("/readyz", healthHandler.Readyz)
+	router.Get("/metrics", promhttp.Handler().ServeHTTP)
+	srv := &http.Server{
+		Addr:    ":" + cfg.WorkerPort,
+		Handler: router,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("listen failed", err)
+		}
+	}()
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		persister.Run(workerCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		janitor.Run(workerCtx)
+	}()
+	slog.Info("worker starting", "port", cfg.WorkerPort,
+		"interval", cfg.EventFlushInterval, "batch_size", cfg.EventFlushBatchSize)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("shutting down worker")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Servers may still be buffering events, which the remaining workers
+	// pick up, so only the batch in progress is finished here.
+	checker.SetDraining()
+	stopWorker()
+	workers.Wait()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("health server forced to shut down", "err", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush spans", "err", err)
+	}
+
+	slog.Info("worker exiting")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
@@ -3,11 +3,19 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// RateLimit is a per-minute request budget with a burst allowance. A zero
+// PerMinute disables the limit.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
 type Config struct {
 	ServerPort      string
 	DBHost          string
@@ -19,10 +27,107 @@ type Config struct {
 	RedisAddr       string
 	RedisPassword   string
 	JWTSecret       string
+	JWTKeysDir      string
+	JWTSigningKeyID string
 	AccessTokenExp  time.Duration
 	RefreshTokenExp time.Duration
-	ProfilePicDir   string
-	ProfilePicRoute string
+	WsTicketTTL     time.Duration
+	// Per-connection token bucket for inbound WebSocket frames.
+	WsFrameRate  float64
+	WsFrameBurst int
+	TOTPIssuer   string
+	// PasswordHashAlgorithm is "argon2id" or "bcrypt". Hashes made with the
+	// other algorithm or other parameters are upgraded on the next login.
+	PasswordHashAlgorithm string
+	Argon2MemoryKB        uint32
+	Argon2Iterations      uint32
+	Argon2Parallelism     uint8
+	BcryptCost            int
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	// BreachedPasswordsFile lists passwords that may not be used, one per
+	// line as plain text or SHA-1 hex.
+	BreachedPasswordsFile string
+	// AppBaseURL is the public address of the web app, used in emailed links.
+	AppBaseURL string
+	// Mailer selects the mail transport: "smtp", "file" or "log".
+	Mailer               string
+	MailFrom             string
+	MailFileDir          string
+	SMTPHost             string
+	SMTPPort             string
+	SMTPUsername         string
+	SMTPPassword         string
+	EmailVerificationTTL time.Duration
+	PasswordResetTTL     time.Duration
+	// Login lockout thresholds and durations.
+	LoginMaxUserFailures int
+	LoginMaxIPFailures   int
+	LoginFailureWindow   time.Duration
+	LoginLockoutBase     time.Duration
+	LoginLockoutMax      time.Duration
+	// RefreshTokenCookie delivers refresh tokens in an HttpOnly cookie
+	// instead of the JSON body.
+	RefreshTokenCookie bool
+	CookieSecure       bool
+	ProfilePicDir      string
+	ProfilePicRoute    string
+	// TrustedProxies are the CIDRs allowed to set X-Forwarded-For.
+	TrustedProxies    []string
+	RateLimitDefault  RateLimit
+	RateLimitLogin    RateLimit
+	RateLimitRegister RateLimit
+	RateLimitSearch   RateLimit
+	// RateLimitWsMessages limits chat messages per user over WebSockets.
+	RateLimitWsMessages RateLimit
+	// LogLevel is the minimum level logged: "debug", "info", "warn" or "error".
+	LogLevel string
+	// TracingExporter sends spans over OTLP ("otlp"), prints them ("stdout")
+	// or drops them ("none"). OTLP is configured with the standard
+	// OTEL_EXPORTER_OTLP_* variables.
+	TracingExporter    string
+	TracingSampleRatio float64
+	// HealthCheckTimeout bounds each readiness check.
+	HealthCheckTimeout time.Duration
+	// ShutdownDrainDelay is how long the server reports not-ready before it
+	// stops accepting connections, giving load balancers time to notice.
+	ShutdownDrainDelay time.Duration
+	// ShutdownTimeout bounds the rest of shutdown: draining WebSocket
+	// connections, finishing HTTP requests and the final event flush.
+	ShutdownTimeout time.Duration
+	// EventWorkerEnabled runs the persistence worker inside the server. Turn
+	// it off when running cmd/worker separately.
+	EventWorkerEnabled bool
+	// EventFlushInterval, EventFlushBatchSize and EventFlushMaxBackoff tune
+	// the persistence worker.
+	EventFlushInterval   time.Duration
+	EventFlushBatchSize  int
+	EventFlushMaxBackoff time.Duration
+	// WorkerPort serves health checks and metrics from cmd/worker.
+	WorkerPort string
+	// EventDurability is "buffered", "sync" or "fallback"; see
+	// usecase.EventDurabilityBuffered and friends.
+	EventDurability string
+	// The Redis buffer is skipped for EventBufferBreakerCooldown after
+	// EventBufferBreakerThreshold consecutive failed writes.
+	EventBufferBreakerThreshold int
+	EventBufferBreakerCooldown  time.Duration
+	// Shared rate limit checks on WebSocket messages fail open for
+	// RateLimitBreakerCooldown after RateLimitBreakerThreshold consecutive
+	// failures.
+	RateLimitBreakerThreshold int
+	RateLimitBreakerCooldown  time.Duration
+	// JanitorInterval and JanitorBatchSize tune the cleanup job, which runs
+	// wherever the persistence worker does.
+	JanitorInterval  time.Duration
+	JanitorBatchSize int
+	// EventRetention holds "type=days" entries overriding
+	// EventRetentionDefaultDays. Zero days keeps events forever.
+	EventRetention            []string
+	EventRetentionDefaultDays int
+	// EventPartitioning is set once events has been partitioned with
+	// migrations/optional/partition_events.sql.
+	EventPartitioning bool
 }
 
 func getEnv(key, fallback string) string {
@@ -32,6 +137,27 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getRateLimit(prefix string, perMinute, burst int) RateLimit {
+	rl := RateLimit{PerMinute: perMinute, Burst: burst}
+	if v, err := strconv.Atoi(getEnv(prefix+"_PER_MIN", "")); err == nil {
+		rl.PerMinute = v
+	}
+	if v, err := strconv.Atoi(getEnv(prefix+"_BURST", "")); err == nil {
+		rl.Burst = v
+	}
+	return rl
+}
+
+func getList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(getEnv(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 func Load() (*Config, error) {
 	if err := godotenv.Load(); err != nil {
 		// Ignore error if .env file is not found, for production environments
@@ -41,6 +167,10 @@ func Load() (*Config, error) {
 	}
 
 	serverPort := getEnv("SERVER_PORT", "8080")
+	logLevel := getEnv("LOG_LEVEL", "info")
+	tracingExporter := getEnv("TRACING_EXPORTER", "none")
+	workerPort := getEnv("WORKER_PORT", "8081")
+	eventDurability := getEnv("EVENT_DURABILITY", "buffered")
 	dbHost := getEnv("DB_HOST", "localhost")
 	dbPort := getEnv("DB_PORT", "5432")
 	dbUser := getEnv("DB_USER", "user")
@@ -50,27 +180,139 @@ func Load() (*Config, error) {
 	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
 	redisPassword := getEnv("REDIS_PASSWORD", "")
 	jwtSecret := getEnv("JWT_SECRET", "a-very-secret-key-that-is-long-enough")
+	jwtKeysDir := getEnv("JWT_KEYS_DIR", "")
+	jwtSigningKeyID := getEnv("JWT_SIGNING_KEY_ID", "default")
+	totpIssuer := getEnv("TOTP_ISSUER", "QuikChat")
+	passwordHashAlgorithm := getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	breachedPasswordsFile := getEnv("BREACHED_PASSWORDS_FILE", "")
+	appBaseURL := getEnv("APP_BASE_URL", "http://localhost:8080")
+	mailer := getEnv("MAILER", "log")
+	mailFrom := getEnv("MAIL_FROM", "QuikChat <no-reply@localhost>")
+	mailFileDir := getEnv("MAIL_FILE_DIR", "./mail")
+	smtpHost := getEnv("SMTP_HOST", "localhost")
+	smtpPort := getEnv("SMTP_PORT", "587")
+	smtpUsername := getEnv("SMTP_USERNAME", "")
+	smtpPassword := getEnv("SMTP_PASSWORD", "")
 	profilePicDir := getEnv("PROFILE_PIC_DIR", "./uploads/profile_pics")
 	profilePicRoute := getEnv("PROFILE_PIC_ROUTE", "/static/profile_pics")
 
 	accessExpMin, _ := strconv.Atoi(getEnv("JWT_ACCESS_TOKEN_EXP_MIN", "10"))
 	refreshExpHour, _ := strconv.Atoi(getEnv("JWT_REFRESH_TOKEN_EXP_HOUR", "8"))
+	wsTicketTTLSec, _ := strconv.Atoi(getEnv("WS_TICKET_TTL_SEC", "30"))
+	emailVerificationTTLHour, _ := strconv.Atoi(getEnv("EMAIL_VERIFICATION_TTL_HOUR", "24"))
+	passwordResetTTLMin, _ := strconv.Atoi(getEnv("PASSWORD_RESET_TTL_MIN", "30"))
+	wsFrameRate, _ := strconv.ParseFloat(getEnv("WS_FRAMES_PER_SEC", "5"), 64)
+	wsFrameBurst, _ := strconv.Atoi(getEnv("WS_FRAME_BURST", "20"))
+	refreshTokenCookie, _ := strconv.ParseBool(getEnv("REFRESH_TOKEN_COOKIE", "false"))
+	cookieSecure, _ := strconv.ParseBool(getEnv("COOKIE_SECURE", "true"))
+	loginMaxUserFailures, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES_PER_USER", "5"))
+	loginMaxIPFailures, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES_PER_IP", "20"))
+	loginFailureWindowMin, _ := strconv.Atoi(getEnv("LOGIN_FAILURE_WINDOW_MIN", "60"))
+	loginLockoutBaseSec, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_BASE_SEC", "60"))
+	loginLockoutMaxMin, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MAX_MIN", "60"))
+	argon2MemoryKB, _ := strconv.ParseUint(getEnv("ARGON2_MEMORY_KB", "65536"), 10, 32)
+	argon2Iterations, _ := strconv.ParseUint(getEnv("ARGON2_ITERATIONS", "3"), 10, 32)
+	argon2Parallelism, _ := strconv.ParseUint(getEnv("ARGON2_PARALLELISM", "2"), 10, 8)
+	bcryptCost, _ := strconv.Atoi(getEnv("BCRYPT_COST", "12"))
+	passwordMinLength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "8"))
+	passwordMaxLength, _ := strconv.Atoi(getEnv("PASSWORD_MAX_LENGTH", "128"))
+	tracingSampleRatio, _ := strconv.ParseFloat(getEnv("TRACING_SAMPLE_RATIO", "1"), 64)
+	healthCheckTimeoutMs, _ := strconv.Atoi(getEnv("HEALTH_CHECK_TIMEOUT_MS", "2000"))
+	shutdownDrainDelaySec, _ := strconv.Atoi(getEnv("SHUTDOWN_DRAIN_DELAY_SEC", "5"))
+	shutdownTimeoutSec, _ := strconv.Atoi(getEnv("SHUTDOWN_TIMEOUT_SEC", "15"))
+	eventWorkerEnabled, _ := strconv.ParseBool(getEnv("EVENT_WORKER_ENABLED", "true"))
+	eventFlushIntervalMs, _ := strconv.Atoi(getEnv("EVENT_FLUSH_INTERVAL_MS", "10000"))
+	eventFlushBatchSize, _ := strconv.Atoi(getEnv("EVENT_FLUSH_BATCH_SIZE", "100"))
+	eventFlushMaxBackoffSec, _ := strconv.Atoi(getEnv("EVENT_FLUSH_MAX_BACKOFF_SEC", "60"))
+	eventBufferBreakerThreshold, _ := strconv.Atoi(getEnv("EVENT_BUFFER_BREAKER_THRESHOLD", "5"))
+	eventBufferBreakerCooldownSec, _ := strconv.Atoi(getEnv("EVENT_BUFFER_BREAKER_COOLDOWN_SEC", "30"))
+	rateLimitBreakerThreshold, _ := strconv.Atoi(getEnv("RATE_LIMIT_BREAKER_THRESHOLD", "5"))
+	rateLimitBreakerCooldownSec, _ := strconv.Atoi(getEnv("RATE_LIMIT_BREAKER_COOLDOWN_SEC", "30"))
+	janitorIntervalMin, _ := strconv.Atoi(getEnv("JANITOR_INTERVAL_MIN", "60"))
+	janitorBatchSize, _ := strconv.Atoi(getEnv("JANITOR_BATCH_SIZE", "1000"))
+	eventRetentionDefaultDays, _ := strconv.Atoi(getEnv("EVENT_RETENTION_DEFAULT_DAYS", "0"))
+	eventPartitioning, _ := strconv.ParseBool(getEnv("EVENT_PARTITIONING", "false"))
+	eventRetention := getList("EVENT_RETENTION_DAYS")
+	trustedProxies := getList("TRUSTED_PROXIES")
+	rateLimitDefault := getRateLimit("RATE_LIMIT_DEFAULT", 300, 10)
+	rateLimitLogin := getRateLimit("RATE_LIMIT_LOGIN", 10, 5)
+	rateLimitRegister := getRateLimit("RATE_LIMIT_REGISTER", 3, 3)
+	rateLimitSearch := getRateLimit("RATE_LIMIT_SEARCH", 30, 10)
+	rateLimitWsMessages := getRateLimit("RATE_LIMIT_WS_MESSAGES", 60, 10)
 
 	cfg := &Config{
-		ServerPort:      serverPort,
-		DBHost:          dbHost,
-		DBPort:          dbPort,
-		DBUser:          dbUser,
-		DBPassword:      dbPassword,
-		DBName:          dbName,
-		DBSslMode:       dbSslMode,
-		RedisAddr:       redisAddr,
-		RedisPassword:   redisPassword,
-		JWTSecret:       jwtSecret,
-		AccessTokenExp:  time.Duration(accessExpMin) * time.Minute,
-		RefreshTokenExp: time.Duration(refreshExpHour) * time.Hour,
-		ProfilePicDir:   profilePicDir,
-		ProfilePicRoute: profilePicRoute,
+		ServerPort:                  serverPort,
+		LogLevel:                    logLevel,
+		TracingExporter:             tracingExporter,
+		TracingSampleRatio:          tracingSampleRatio,
+		HealthCheckTimeout:          time.Duration(healthCheckTimeoutMs) * time.Millisecond,
+		ShutdownDrainDelay:          time.Duration(shutdownDrainDelaySec) * time.Second,
+		ShutdownTimeout:             time.Duration(shutdownTimeoutSec) * time.Second,
+		EventWorkerEnabled:          eventWorkerEnabled,
+		EventFlushInterval:          time.Duration(eventFlushIntervalMs) * time.Millisecond,
+		EventFlushBatchSize:         eventFlushBatchSize,
+		EventFlushMaxBackoff:        time.Duration(eventFlushMaxBackoffSec) * time.Second,
+		WorkerPort:                  workerPort,
+		EventDurability:             eventDurability,
+		EventBufferBreakerThreshold: eventBufferBreakerThreshold,
+		EventBufferBreakerCooldown:  time.Duration(eventBufferBreakerCooldownSec) * time.Second,
+		RateLimitBreakerThreshold:   rateLimitBreakerThreshold,
+		RateLimitBreakerCooldown:    time.Duration(rateLimitBreakerCooldownSec) * time.Second,
+		JanitorInterval:             time.Duration(janitorIntervalMin) * time.Minute,
+		JanitorBatchSize:            janitorBatchSize,
+		EventRetention:              eventRetention,
+		EventRetentionDefaultDays:   eventRetentionDefaultDays,
+		EventPartitioning:           eventPartitioning,
+		DBHost:                      dbHost,
+		DBPort:                      dbPort,
+		DBUser:                      dbUser,
+		DBPassword:                  dbPassword,
+		DBName:                      dbName,
+		DBSslMode:                   dbSslMode,
+		RedisAddr:                   redisAddr,
+		RedisPassword:               redisPassword,
+		JWTSecret:                   jwtSecret,
+		JWTKeysDir:                  jwtKeysDir,
+		JWTSigningKeyID:             jwtSigningKeyID,
+		AccessTokenExp:              time.Duration(accessExpMin) * time.Minute,
+		RefreshTokenExp:             time.Duration(refreshExpHour) * time.Hour,
+		WsTicketTTL:                 time.Duration(wsTicketTTLSec) * time.Second,
+		WsFrameRate:                 wsFrameRate,
+		WsFrameBurst:                wsFrameBurst,
+		TOTPIssuer:                  totpIssuer,
+		PasswordHashAlgorithm:       passwordHashAlgorithm,
+		Argon2MemoryKB:              uint32(argon2MemoryKB),
+		Argon2Iterations:            uint32(argon2Iterations),
+		Argon2Parallelism:           uint8(argon2Parallelism),
+		BcryptCost:                  bcryptCost,
+		PasswordMinLength:           passwordMinLength,
+		PasswordMaxLength:           passwordMaxLength,
+		BreachedPasswordsFile:       breachedPasswordsFile,
+		AppBaseURL:                  appBaseURL,
+		Mailer:                      mailer,
+		MailFrom:                    mailFrom,
+		MailFileDir:                 mailFileDir,
+		SMTPHost:                    smtpHost,
+		SMTPPort:                    smtpPort,
+		SMTPUsername:                smtpUsername,
+		SMTPPassword:                smtpPassword,
+		EmailVerificationTTL:        time.Duration(emailVerificationTTLHour) * time.Hour,
+		PasswordResetTTL:            time.Duration(passwordResetTTLMin) * time.Minute,
+		LoginMaxUserFailures:        loginMaxUserFailures,
+		LoginMaxIPFailures:          loginMaxIPFailures,
+		LoginFailureWindow:          time.Duration(loginFailureWindowMin) * time.Minute,
+		LoginLockoutBase:            time.Duration(loginLockoutBaseSec) * time.Second,
+		LoginLockoutMax:             time.Duration(loginLockoutMaxMin) * time.Minute,
+		RefreshTokenCookie:          refreshTokenCookie,
+		CookieSecure:                cookieSecure,
+		ProfilePicDir:               profilePicDir,
+		ProfilePicRoute:             profilePicRoute,
+		TrustedProxies:              trustedProxies,
+		RateLimitDefault:            rateLimitDefault,
+		RateLimitLogin:              rateLimitLogin,
+		RateLimitRegister:           rateLimitRegister,
+		RateLimitSearch:             rateLimitSearch,
+		RateLimitWsMessages:         rateLimitWsMessages,
 	}
 
 	if err := os.MkdirAll(cfg.ProfilePicDir, os.ModePerm); err != nil {
@@ -79,4 +321,3 @@ func Load() (*Config, error) {
 
 	return cfg, nil
 }
-
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadRateLimits(t *testing.T) {
+	t.Setenv("PROFILE_PIC_DIR", t.TempDir())
+	t.Setenv("RATE_LIMIT_LOGIN_PER_MIN", "20")
+	t.Setenv("RATE_LIMIT_LOGIN_BURST", "2")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  RateLimit
+		want RateLimit
+	}{
+		{"default", cfg.RateLimitDefault, RateLimit{PerMinute: 300, Burst: 10}},
+		{"login", cfg.RateLimitLogin, RateLimit{PerMinute: 20, Burst: 2}},
+		{"register", cfg.RateLimitRegister, RateLimit{PerMinute: 3, Burst: 3}},
+		{"search", cfg.RateLimitSearch, RateLimit{PerMinute: 30, Burst: 10}},
+		{"ws messages", cfg.RateLimitWsMessages, RateLimit{PerMinute: 60, Burst: 10}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s rate limit = %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if want := []string{"10.0.0.0/8", "192.0.2.1"}; !reflect.DeepEqual(cfg.TrustedProxies, want) {
+		t.Errorf("TrustedProxies = %q, want %q", cfg.TrustedProxies, want)
+	}
+}
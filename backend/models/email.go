@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EmailTokenPurpose string
+
+const (
+	EmailTokenVerifyEmail   EmailTokenPurpose = "verify_email"
+	EmailTokenPasswordReset EmailTokenPurpose = "password_reset"
+)
+
+// EmailToken is a single-use token delivered by email. Only the hash of the
+// token is stored, so a database leak does not expose usable links.
+type EmailToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   EmailTokenPurpose
+	// Email is the address the token was sent to. A verification token only
+	// verifies that exact address.
+	Email     string
+	ExpiresAt time.Time
+}
+
+// Email is an outgoing plain text message.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -1,6 +1,9 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// User & Auth
@@ -8,10 +11,28 @@ var (
 	ErrUsernameTaken      = errors.New("username is already taken")
 	ErrInvalidCredentials = errors.New("invalid username or password")
 	ErrSessionNotFound    = errors.New("session not found or expired")
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenRevoked       = errors.New("token has been revoked")
 	ErrUnauthorized       = errors.New("unauthorized")
 	ErrInternalServer     = errors.New("internal server error")
 	ErrBadRequest         = errors.New("bad request")
+	ErrForbidden          = errors.New("forbidden")
+	ErrAccountLocked      = errors.New("too many failed login attempts, try again later")
+	ErrWeakPassword       = errors.New("password does not meet the password policy")
+	ErrInvalidProfile     = errors.New("invalid profile field")
+	ErrTicketNotFound     = errors.New("websocket ticket not found or expired")
+
+	// Two-factor authentication
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrChallengeNotFound       = errors.New("login challenge not found or expired")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+
+	// Email
+	ErrInvalidEmail      = errors.New("invalid email address")
+	ErrEmailTaken        = errors.New("email is already in use")
+	ErrEmailTokenInvalid = errors.New("link is invalid or has expired")
 
 	// Friendship
 	ErrFriendRequestExists   = errors.New("friend request already exists")
@@ -19,6 +40,9 @@ var (
 	ErrNotFriends            = errors.New("users are not friends")
 	ErrFriendRequestNotFound = errors.New("friend request not found")
 	ErrCannotFriendSelf      = errors.New("cannot send friend request to yourself")
+	ErrUserBlocked           = errors.New("you have blocked this user")
+	ErrCannotBlockSelf       = errors.New("cannot block yourself")
+	ErrBlockNotFound         = errors.New("user is not blocked")
 
 	// Group
 	ErrGroupNotFound      = errors.New("group not found")
@@ -27,4 +51,34 @@ var (
 	ErrNotGroupMember     = errors.New("user is not a group member")
 	ErrAlreadyGroupMember = errors.New("user is already a group member")
 	ErrCannotRemoveOwner  = errors.New("cannot remove the group owner")
+
+	// Events
+	ErrInvalidEvent = errors.New("event rejected by storage")
 )
+
+// LockoutError reports a temporary login lockout and when it ends.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string { return ErrAccountLocked.Error() }
+
+func (e *LockoutError) Unwrap() error { return ErrAccountLocked }
+
+// PasswordPolicyError explains why a new password was rejected.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string { return e.Reason }
+
+func (e *PasswordPolicyError) Unwrap() error { return ErrWeakPassword }
+
+// ProfileValidationError explains why a profile field was rejected.
+type ProfileValidationError struct {
+	Reason string
+}
+
+func (e *ProfileValidationError) Error() string { return e.Reason }
+
+func (e *ProfileValidationError) Unwrap() error { return ErrInvalidProfile }
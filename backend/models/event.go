@@ -25,6 +25,9 @@ const (
 	EventRemovedFromGroup EventType = "removed_from_group"
 	EventUserJoinedGroup  EventType = "user_joined_group"
 	EventUserLeftGroup    EventType = "user_left_group"
+
+	// Security
+	EventSecurityAlert EventType = "security_alert"
 )
 
 type Event struct {
@@ -34,5 +37,11 @@ type Event struct {
 	RecipientID uuid.UUID       `json:"-"`
 	CreatedAt   time.Time       `json:"createdAt"`
 	SenderID    *uuid.UUID      `json:"senderId,omitempty"` // Optional, for messages etc.
+	// TraceContext is the W3C trace context of the operation that created
+	// the event, so that its delivery can be traced back to it.
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+	// BufferID identifies the event in the Redis buffer while it waits to
+	// be stored.
+	BufferID string `json:"-"`
 }
 
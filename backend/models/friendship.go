@@ -20,3 +20,11 @@ type Friendship struct {
 	CreatedAt time.Time        `json:"createdAt"`
 }
 
+// FriendSuggestion is a user the caller may know, with the connections that
+// led to the suggestion.
+type FriendSuggestion struct {
+	User          *User `json:"user"`
+	MutualFriends int   `json:"mutualFriends"`
+	SharedGroups  int   `json:"sharedGroups"`
+}
+
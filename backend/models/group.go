@@ -7,12 +7,20 @@ import (
 )
 
 type Group struct {
-	ID        uuid.UUID `json:"id"`
-	Handle    string    `json:"handle"`
-	Name      string    `json:"name"`
-	PhotoURL  string    `json:"photoUrl"`
-	OwnerID   uuid.UUID `json:"ownerId"`
+	ID       uuid.UUID `json:"id"`
+	Handle   string    `json:"handle"`
+	Name     string    `json:"name"`
+	PhotoURL string    `json:"photoUrl"`
+	OwnerID  uuid.UUID `json:"ownerId"`
+	// SlowModeSeconds is the minimum gap between two messages from the same
+	// member. Zero disables slow mode.
+	SlowModeSeconds int `json:"slowModeSeconds"`
+	// IsPrivate groups are left out of search and can only be joined by
+	// being added by a member.
+	IsPrivate bool      `json:"isPrivate"`
 	CreatedAt time.Time `json:"createdAt"`
+	// MemberCount is only filled in by search.
+	MemberCount int `json:"memberCount,omitempty"`
 }
 
 type GroupMember struct {
@@ -20,4 +28,3 @@ type GroupMember struct {
 	UserID   uuid.UUID `json:"userId"`
 	JoinedAt time.Time `json:"joinedAt"`
 }
-
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageSearchQuery is a full-text search over the caller's conversations.
+// Nil filters are not applied.
+type MessageSearchQuery struct {
+	Text string
+	// SenderID limits results to messages sent by one user.
+	SenderID *uuid.UUID
+	// ConversationID is a group ID, or the other user's ID for a direct
+	// conversation.
+	ConversationID *uuid.UUID
+	From           *time.Time
+	To             *time.Time
+	After          *MessageSearchCursor
+	Limit          int
+}
+
+// MessageSearchCursor marks the last result of a page. Results are ordered
+// newest first, so the next page starts strictly after it.
+type MessageSearchCursor struct {
+	CreatedAt time.Time `json:"t"`
+	EventID   uuid.UUID `json:"e"`
+}
+
+type MessageSearchResult struct {
+	// EventID is the stored row the result came from, used for paging.
+	EventID        uuid.UUID  `json:"-"`
+	MessageID      uuid.UUID  `json:"messageId"`
+	ConversationID *uuid.UUID `json:"conversationId"`
+	SenderID       *uuid.UUID `json:"senderId"`
+	Content        string     `json:"content"`
+	// Snippet is HTML-escaped content with the matched terms wrapped in
+	// <mark> tags.
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type MessageSearchPage struct {
+	Results []*MessageSearchResult `json:"results"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
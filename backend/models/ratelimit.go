@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RateLimitPolicy allows Limit requests per Period, with up to Burst requests
+// admitted back to back.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// RateLimitResult is the outcome of charging one request against a policy.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long a rejected caller must wait before retrying.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full burst is available again.
+	ResetAfter time.Duration
+}
@@ -6,9 +6,29 @@ import (
 	"github.com/google/uuid"
 )
 
+// Session is a single refresh token. Every refresh rotates the token, and all
+// tokens descending from the same login share a FamilyID so that the whole
+// chain can be revoked when a rotated token is replayed.
 type Session struct {
-	RefreshToken uuid.UUID `json:"refreshToken"`
-	UserID       uuid.UUID `json:"userId"`
-	ExpiresAt    time.Time `json:"expiresAt"`
+	RefreshToken uuid.UUID  `json:"refreshToken"`
+	UserID       uuid.UUID  `json:"userId"`
+	FamilyID     uuid.UUID  `json:"familyId"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RotatedAt    *time.Time `json:"rotatedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
 }
 
+// LoginResult is the outcome of a password login. When the account has
+// two-factor authentication enabled only ChallengeToken is set, and it must be
+// exchanged together with a TOTP or recovery code for the token pair.
+type LoginResult struct {
+	AccessToken    string
+	RefreshToken   string
+	ChallengeToken string
+}
+
+// LoginChallenge is the pending second step of a two-factor login.
+type LoginChallenge struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"userId"`
+}
@@ -6,11 +6,49 @@ import (
 	"github.com/google/uuid"
 )
 
+// LastSeenVisibility controls who may see when a user was last online.
+type LastSeenVisibility string
+
+const (
+	LastSeenEveryone LastSeenVisibility = "everyone"
+	LastSeenFriends  LastSeenVisibility = "friends"
+	LastSeenNobody   LastSeenVisibility = "nobody"
+)
+
+// UserStatus is a short custom status shown next to a user's name. It is
+// hidden once ExpiresAt has passed.
+type UserStatus struct {
+	Text      string     `json:"text"`
+	Emoji     string     `json:"emoji"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (s *UserStatus) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	ProfilePicURL string    `json:"profilePicUrl"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID            uuid.UUID   `json:"id"`
+	Username      string      `json:"username"`
+	DisplayName   string      `json:"displayName"`
+	Bio           string      `json:"bio"`
+	Status        *UserStatus `json:"status,omitempty"`
+	PasswordHash  string      `json:"-"`
+	ProfilePicURL string      `json:"profilePicUrl"`
+	// LastSeenAt is omitted when the viewer may not see it.
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	// LastSeenVisibility is only shown to the user themselves.
+	LastSeenVisibility LastSeenVisibility `json:"lastSeenVisibility,omitempty"`
+	TOTPSecret         string             `json:"-"`
+	TOTPEnabled        bool               `json:"-"`
+	IsAdmin            bool               `json:"-"`
+	Email              string             `json:"-"`
+	EmailVerified      bool               `json:"-"`
+	CreatedAt          time.Time          `json:"createdAt"`
 }
 
+// TOTPEnrollment is returned when a user starts enrolling an authenticator.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WsTicket is a short-lived, single-use credential that authenticates a
+// WebSocket upgrade on behalf of the access token that requested it.
+type WsTicket struct {
+	ID             uuid.UUID `json:"id"`
+	UserID         uuid.UUID `json:"userId"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt"`
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type BlockRepository interface {
+	Block(ctx context.Context, blockerID, blockedID uuid.UUID) error
+	Unblock(ctx context.Context, blockerID, blockedID uuid.UUID) error
+	// IsBlocked reports whether blockerID has blocked blockedID.
+	IsBlocked(ctx context.Context, blockerID, blockedID uuid.UUID) (bool, error)
+	ListBlocked(ctx context.Context, blockerID uuid.UUID) ([]*models.User, error)
+}
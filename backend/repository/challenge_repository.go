@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoginChallengeRepository interface {
+	Create(ctx context.Context, challenge *models.LoginChallenge, ttl time.Duration) error
+	Find(ctx context.Context, challengeID uuid.UUID) (*models.LoginChallenge, error)
+	Delete(ctx context.Context, challengeID uuid.UUID) error
+	// IncrementAttempts records a failed verification and returns the total.
+	IncrementAttempts(ctx context.Context, challengeID uuid.UUID) (int64, error)
+}
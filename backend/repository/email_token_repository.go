@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type EmailTokenRepository interface {
+	Create(ctx context.Context, token *models.EmailToken) error
+	// Consume deletes and returns an unexpired token. It returns
+	// models.ErrEmailTokenInvalid if there is no such token.
+	Consume(ctx context.Context, tokenHash string, purpose models.EmailTokenPurpose) (*models.EmailToken, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID, purpose models.EmailTokenPurpose) error
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// EventPartitionRepository manages the monthly partitions of the events
+// table once it has been partitioned.
+type EventPartitionRepository interface {
+	// EnsurePartitions creates the partitions for the month containing from
+	// and the months after it, months in total, unless they exist.
+	EnsurePartitions(ctx context.Context, from time.Time, months int) error
+	// DropPartitionsBefore drops the partitions that end on or before cutoff
+	// and returns their names.
+	DropPartitionsBefore(ctx context.Context, cutoff time.Time) ([]string, error)
+}
@@ -13,10 +13,23 @@ type EventRepository interface {
 	BufferEvent(ctx context.Context, event *models.Event) error
 	GetBufferedEvents(ctx context.Context, count int) ([]*models.Event, error)
 	DeleteBufferedEvents(ctx context.Context, events []*models.Event) error
+	CountBufferedEvents(ctx context.Context) (int64, error)
+	// DeadLetterBufferedEvent moves an event that can never be stored out of
+	// the buffer, keeping it with reason for inspection.
+	DeadLetterBufferedEvent(ctx context.Context, event *models.Event, reason string) error
 
 	// For Postgres (durable storage)
 	Store(ctx context.Context, event *models.Event) error
 	FetchUndelivered(ctx context.Context, userID uuid.UUID, cursor time.Time, limit int) ([]*models.Event, error)
 	Delete(ctx context.Context, eventID uuid.UUID) error
 	StoreBatch(ctx context.Context, events []*models.Event) error
+	// ListMessages returns every stored chat message sent or received by
+	// userID, one row per message, oldest first.
+	ListMessages(ctx context.Context, userID uuid.UUID) ([]*models.Event, error)
+	// DeleteTypeBefore deletes up to limit events of eventType created before
+	// cutoff and returns how many it deleted.
+	DeleteTypeBefore(ctx context.Context, eventType models.EventType, cutoff time.Time, limit int) (int64, error)
+	// DeleteBeforeExcept deletes up to limit events of any type but
+	// exceptTypes created before cutoff and returns how many it deleted.
+	DeleteBeforeExcept(ctx context.Context, cutoff time.Time, exceptTypes []models.EventType, limit int) (int64, error)
 }
@@ -1,8 +1,13 @@
 package repository
 
-import "mime/multipart"
+import (
+	"io"
+	"mime/multipart"
+)
 
 type FileRepository interface {
 	Save(file multipart.File, header *multipart.FileHeader) (string, error)
+	// Open and Delete take the URL returned by Save.
+	Open(fileURL string) (io.ReadCloser, error)
+	Delete(fileURL string) error
 }
-
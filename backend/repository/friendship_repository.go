@@ -13,4 +13,7 @@ type FriendshipRepository interface {
 	Delete(ctx context.Context, userID1, userID2 uuid.UUID) error
 	Find(ctx context.Context, userID1, userID2 uuid.UUID) (*models.Friendship, error)
 	ListByUserID(ctx context.Context, userID uuid.UUID, status models.FriendshipStatus) ([]*models.User, error)
+	// ListSuggestions ranks users who are not yet friends with userID by
+	// mutual friends and shared groups. Blocked users are left out.
+	ListSuggestions(ctx context.Context, userID uuid.UUID, limit int) ([]*models.FriendSuggestion, error)
 }
@@ -13,7 +13,10 @@ type GroupRepository interface {
 	Delete(ctx context.Context, groupID uuid.UUID) error
 	FindByID(ctx context.Context, groupID uuid.UUID) (*models.Group, error)
 	FindByHandle(ctx context.Context, handle string) (*models.Group, error)
-	FuzzySearchByHandle(ctx context.Context, query string, limit int) ([]*models.Group, error)
+	// Search ranks public groups by how well their handle or name matches
+	// query, including member counts.
+	Search(ctx context.Context, query string, limit, offset int) ([]*models.Group, error)
+	ListByMember(ctx context.Context, userID uuid.UUID) ([]*models.Group, error)
 
 	AddMember(ctx context.Context, member *models.GroupMember) error
 	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error
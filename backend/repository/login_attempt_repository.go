@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttemptRepository tracks failed logins per subject (a username or a
+// client IP) and the temporary lockouts derived from them.
+type LoginAttemptRepository interface {
+	// LockedFor returns how long subject remains locked out, or zero.
+	LockedFor(ctx context.Context, subject string) (time.Duration, error)
+	// RecordFailure counts a failure and returns the total within window.
+	RecordFailure(ctx context.Context, subject string, window time.Duration) (int64, error)
+	Lock(ctx context.Context, subject string, duration time.Duration) error
+	// Reset clears both the failure counter and any lockout.
+	Reset(ctx context.Context, subject string) error
+}
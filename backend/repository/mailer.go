@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+)
+
+// Mailer delivers outgoing email.
+type Mailer interface {
+	Send(ctx context.Context, email *models.Email) error
+}
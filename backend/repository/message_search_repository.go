@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type MessageSearchRepository interface {
+	// Search returns the messages matching query in conversations userID
+	// takes part in now: their direct messages and the groups they are
+	// still a member of. Results are newest first.
+	Search(ctx context.Context, userID uuid.UUID, query models.MessageSearchQuery) ([]*models.MessageSearchResult, error)
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+
+	"chat-app/backend/models"
+)
+
+// RateLimitRepository keeps rate limit state where every replica can see it.
+type RateLimitRepository interface {
+	// Allow charges one request for key against policy.
+	Allow(ctx context.Context, key string, policy models.RateLimitPolicy) (*models.RateLimitResult, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type RecoveryCodeRepository interface {
+	// ReplaceAll discards the user's existing codes and stores the new hashes.
+	ReplaceAll(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	// Consume marks an unused code as used, returning
+	// models.ErrInvalidTwoFactorCode if there is none.
+	Consume(ctx context.Context, userID uuid.UUID, codeHash string) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"chat-app/backend/models"
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -10,7 +11,16 @@ import (
 type SessionRepository interface {
 	Create(ctx context.Context, session *models.Session) error
 	Find(ctx context.Context, refreshToken uuid.UUID) (*models.Session, error)
+	// Rotate marks oldToken as rotated and stores its successor atomically. It
+	// returns models.ErrRefreshTokenReused if oldToken was already rotated.
+	Rotate(ctx context.Context, oldToken uuid.UUID, next *models.Session) error
 	Delete(ctx context.Context, refreshToken uuid.UUID) error
+	DeleteByFamilyID(ctx context.Context, familyID uuid.UUID) error
 	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	// DeleteByUserIDExcept deletes every session of the user outside of the
+	// keepFamilyID family.
+	DeleteByUserIDExcept(ctx context.Context, userID, keepFamilyID uuid.UUID) error
+	// DeleteExpired deletes up to limit sessions that expired before cutoff
+	// and returns how many it deleted.
+	DeleteExpired(ctx context.Context, cutoff time.Time, limit int) (int64, error)
 }
-
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"chat-app/backend/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TicketRepository interface {
+	Create(ctx context.Context, ticket *models.WsTicket, ttl time.Duration) error
+	// Consume atomically fetches and removes a ticket so it can only be used once.
+	Consume(ctx context.Context, ticketID uuid.UUID) (*models.WsTicket, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenDenyListRepository tracks access tokens that were revoked before they
+// expired. Entries only need to live as long as the tokens they cover.
+type TokenDenyListRepository interface {
+	RevokeToken(ctx context.Context, tokenID uuid.UUID, ttl time.Duration) error
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID, issuedBefore time.Time, ttl time.Duration) error
+	IsRevoked(ctx context.Context, tokenID, userID uuid.UUID, issuedAt time.Time) (bool, error)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"chat-app/backend/models"
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -11,6 +12,24 @@ type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
 	FindByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// FindByEmail finds the account that verified email.
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	// Search matches usernames and display names by prefix and trigram
+	// similarity. The viewer and users blocked either way are left out.
+	Search(ctx context.Context, viewerID uuid.UUID, query string, limit int) ([]*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	// UpdatePasswordHash replaces only the stored hash, so that a concurrent
+	// profile edit is not overwritten with a stale copy of the row.
+	UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error
+	// UpdateStatus replaces the custom status; nil clears it.
+	UpdateStatus(ctx context.Context, userID uuid.UUID, status *models.UserStatus) error
+	UpdateLastSeen(ctx context.Context, userID uuid.UUID, at time.Time) error
+	// Delete removes the user. Sessions, friendships, group memberships and
+	// events addressed to them cascade in the database.
+	Delete(ctx context.Context, id uuid.UUID) error
+	UpdateEmail(ctx context.Context, userID uuid.UUID, email string, verified bool) error
+	UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error
+	// MarkTOTPStepUsed records the time step of an accepted TOTP code. It
+	// returns false if that step (or a later one) was already used.
+	MarkTOTPStepUsed(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
 }
-
@@ -5,110 +5,572 @@ import (
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+// LockoutPolicy controls brute-force protection on login. Failures are
+// counted separately per username and per client IP; once a counter reaches
+// its threshold the subject is locked out for BaseLockout, doubling with every
+// further failure up to MaxLockout.
+type LockoutPolicy struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	FailureWindow   time.Duration
+	BaseLockout     time.Duration
+	MaxLockout      time.Duration
+}
+
 type AuthUsecase interface {
-	Login(ctx context.Context, username, password string) (accessToken string, refreshToken string, err error)
-	Refresh(ctx context.Context, refreshToken string) (newAccessToken string, err error)
-	Logout(ctx context.Context, refreshToken string) error
+	Login(ctx context.Context, username, password, clientIP string) (*models.LoginResult, error)
+	CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, clientIP string) (*models.LoginResult, error)
+	UnlockAccount(ctx context.Context, adminID uuid.UUID, username string) error
+	// ClearLockout lifts a lockout on username once the owner has proved
+	// control of the account some other way, such as a password reset.
+	ClearLockout(ctx context.Context, username string) error
+	Refresh(ctx context.Context, refreshToken string) (newAccessToken string, newRefreshToken string, err error)
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+	ValidateAccessToken(ctx context.Context, accessToken string) (*util.AccessClaims, error)
+	// VerifyPassword re-authenticates a signed-in user before a sensitive
+	// change. Wrong passwords count towards the login lockout, so a stolen
+	// access token does not allow unlimited guesses.
+	VerifyPassword(ctx context.Context, user *models.User, password, clientIP string) error
+	// ChangePassword replaces the password after checking the current one.
+	// Every other session is signed out and a fresh access token for the
+	// calling session is returned.
+	ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, currentPassword, newPassword, clientIP string) (string, error)
+	// DisableTwoFactor turns off two-factor authentication after checking
+	// both factors.
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, password, code, clientIP string) error
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+	JWKS() util.JWKSet
+	IssueWsTicket(ctx context.Context, userID uuid.UUID, tokenExpiresAt time.Time) (string, error)
+	RedeemWsTicket(ctx context.Context, ticket string) (userID uuid.UUID, tokenExpiresAt time.Time, err error)
 }
 
 type authUsecase struct {
-	userRepo    repository.UserRepository
-	sessionRepo repository.SessionRepository
-	tokenGen    util.TokenGenerator
+	userRepo         repository.UserRepository
+	sessionRepo      repository.SessionRepository
+	ticketRepo       repository.TicketRepository
+	denyList         repository.TokenDenyListRepository
+	challengeRepo    repository.LoginChallengeRepository
+	attemptRepo      repository.LoginAttemptRepository
+	tokenGen         util.TokenGenerator
+	passwordHasher   util.PasswordHasher
+	passwordPolicy   *util.PasswordPolicy
+	eventUsecase     EventUsecase
+	twoFactorUsecase TwoFactorUsecase
+	lockout          LockoutPolicy
+	wsTicketTTL      time.Duration
 }
 
-func NewAuthUsecase(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, tokenGen util.TokenGenerator) AuthUsecase {
+func NewAuthUsecase(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, ticketRepo repository.TicketRepository, denyList repository.TokenDenyListRepository, challengeRepo repository.LoginChallengeRepository, attemptRepo repository.LoginAttemptRepository, tokenGen util.TokenGenerator, passwordHasher util.PasswordHasher, passwordPolicy *util.PasswordPolicy, eventUsecase EventUsecase, twoFactorUsecase TwoFactorUsecase, lockout LockoutPolicy, wsTicketTTL time.Duration) AuthUsecase {
 	return &authUsecase{
-		userRepo:    userRepo,
-		sessionRepo: sessionRepo,
-		tokenGen:    tokenGen,
+		userRepo:         userRepo,
+		sessionRepo:      sessionRepo,
+		ticketRepo:       ticketRepo,
+		denyList:         denyList,
+		challengeRepo:    challengeRepo,
+		attemptRepo:      attemptRepo,
+		tokenGen:         tokenGen,
+		passwordHasher:   passwordHasher,
+		passwordPolicy:   passwordPolicy,
+		eventUsecase:     eventUsecase,
+		twoFactorUsecase: twoFactorUsecase,
+		lockout:          lockout,
+		wsTicketTTL:      wsTicketTTL,
 	}
 }
 
-func (a *authUsecase) Login(ctx context.Context, username, password string) (string, string, error) {
+func (a *authUsecase) Login(ctx context.Context, username, password, clientIP string) (*models.LoginResult, error) {
+	if err := a.checkLockout(ctx, username, clientIP); err != nil {
+		return nil, err
+	}
+
 	user, err := a.userRepo.FindByUsername(ctx, username)
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
-			return "", "", models.ErrInvalidCredentials
+			// Unknown usernames are counted too, so lockouts do not reveal
+			// which accounts exist.
+			if err := a.recordLoginFailure(ctx, username, clientIP, nil); err != nil {
+				return nil, err
+			}
+			return nil, models.ErrInvalidCredentials
 		}
-		return "", "", err
+		return nil, err
+	}
+
+	ok, needsRehash := a.passwordHasher.Verify(password, user.PasswordHash)
+	if !ok {
+		if err := a.recordLoginFailure(ctx, username, clientIP, user); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrInvalidCredentials
+	}
+	if needsRehash {
+		a.rehashPassword(ctx, user.ID, password)
 	}
 
-	if !util.CheckPasswordHash(password, user.PasswordHash) {
-		return "", "", models.ErrInvalidCredentials
+	if user.TOTPEnabled {
+		challenge := &models.LoginChallenge{ID: uuid.New(), UserID: user.ID}
+		if err := a.challengeRepo.Create(ctx, challenge, loginChallengeTTL); err != nil {
+			return nil, err
+		}
+		return &models.LoginResult{ChallengeToken: challenge.ID.String()}, nil
 	}
 
+	if err := a.attemptRepo.Reset(ctx, userLoginSubject(username)); err != nil {
+		return nil, err
+	}
+
+	return a.startSession(ctx, user.ID)
+}
+
+func (a *authUsecase) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, clientIP string) (*models.LoginResult, error) {
+	challengeID, err := uuid.Parse(challengeToken)
+	if err != nil {
+		return nil, models.ErrChallengeNotFound
+	}
+
+	challenge, err := a.challengeRepo.Find(ctx, challengeID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkLockout(ctx, user.Username, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := a.twoFactorUsecase.VerifyCode(ctx, user, code); err != nil {
+		if !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+			return nil, err
+		}
+		// Wrong codes count towards the lockout as well, otherwise an attacker
+		// holding the password could request fresh challenges indefinitely.
+		if err := a.recordLoginFailure(ctx, user.Username, clientIP, user); err != nil {
+			return nil, err
+		}
+		// Burn the challenge after a few wrong guesses so the six-digit code
+		// space cannot be searched within one challenge's lifetime.
+		attempts, incrErr := a.challengeRepo.IncrementAttempts(ctx, challengeID)
+		if incrErr == nil && attempts >= maxChallengeAttempts {
+			if err := a.challengeRepo.Delete(ctx, challengeID); err != nil {
+				slog.WarnContext(ctx, "failed to burn login challenge", "err", err)
+			}
+		}
+		return nil, err
+	}
+
+	if err := a.challengeRepo.Delete(ctx, challengeID); err != nil {
+		return nil, err
+	}
+	if err := a.attemptRepo.Reset(ctx, userLoginSubject(user.Username)); err != nil {
+		return nil, err
+	}
+
+	return a.startSession(ctx, user.ID)
+}
+
+// UnlockAccount lifts a lockout on username. Only admins may call it.
+func (a *authUsecase) UnlockAccount(ctx context.Context, adminID uuid.UUID, username string) error {
+	admin, err := a.userRepo.FindByID(ctx, adminID)
+	if err != nil {
+		return err
+	}
+	if !admin.IsAdmin {
+		return models.ErrForbidden
+	}
+
+	if _, err := a.userRepo.FindByUsername(ctx, username); err != nil {
+		return err
+	}
+	return a.ClearLockout(ctx, username)
+}
+
+func (a *authUsecase) ClearLockout(ctx context.Context, username string) error {
+	return a.attemptRepo.Reset(ctx, userLoginSubject(username))
+}
+
+func userLoginSubject(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipLoginSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func (a *authUsecase) checkLockout(ctx context.Context, username, clientIP string) error {
+	for _, subject := range []string{userLoginSubject(username), ipLoginSubject(clientIP)} {
+		lockedFor, err := a.attemptRepo.LockedFor(ctx, subject)
+		if err != nil {
+			return err
+		}
+		if lockedFor > 0 {
+			return &models.LockoutError{RetryAfter: lockedFor}
+		}
+	}
+	return nil
+}
+
+// rehashPassword upgrades a stored hash made with outdated settings. The
+// login has already succeeded, so a failure is only logged and retried on the
+// next login.
+func (a *authUsecase) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hashedPassword, err := a.passwordHasher.Hash(password)
+	if err == nil {
+		err = a.userRepo.UpdatePasswordHash(ctx, userID, hashedPassword)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to rehash password", "user_id", userID, "err", err)
+	}
+}
+
+// recordLoginFailure counts a failed attempt against both the username and
+// the client IP, and warns the account owner when it gets locked out.
+func (a *authUsecase) recordLoginFailure(ctx context.Context, username, clientIP string, user *models.User) error {
+	userLockout, err := a.recordFailure(ctx, userLoginSubject(username), a.lockout.MaxUserFailures)
+	if err != nil {
+		return err
+	}
+	if _, err := a.recordFailure(ctx, ipLoginSubject(clientIP), a.lockout.MaxIPFailures); err != nil {
+		return err
+	}
+
+	if userLockout > 0 && user != nil {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"reason":           "login_lockout",
+			"ip":               clientIP,
+			"lockedForSeconds": int(userLockout.Seconds()),
+		})
+		event := &models.Event{
+			ID:          uuid.New(),
+			Type:        models.EventSecurityAlert,
+			Payload:     payload,
+			RecipientID: user.ID,
+			CreatedAt:   time.Now().UTC(),
+		}
+		return a.eventUsecase.StoreEvent(ctx, event)
+	}
+	return nil
+}
+
+// recordFailure counts a failure for subject and, once threshold is reached,
+// locks it out with exponential backoff. It returns the lockout applied.
+func (a *authUsecase) recordFailure(ctx context.Context, subject string, threshold int) (time.Duration, error) {
+	failures, err := a.attemptRepo.RecordFailure(ctx, subject, a.lockout.FailureWindow)
+	if err != nil {
+		return 0, err
+	}
+	if failures < int64(threshold) {
+		return 0, nil
+	}
+
+	lockout := a.lockout.MaxLockout
+	if exp := failures - int64(threshold); exp < 32 {
+		if d := a.lockout.BaseLockout << exp; d > 0 && d < lockout {
+			lockout = d
+		}
+	}
+	return lockout, a.attemptRepo.Lock(ctx, subject, lockout)
+}
+
+// startSession issues a token pair in a new refresh token family.
+func (a *authUsecase) startSession(ctx context.Context, userID uuid.UUID) (*models.LoginResult, error) {
 	// Single device policy: remove old sessions
-	if err := a.sessionRepo.DeleteByUserID(ctx, user.ID); err != nil {
-		// Log error but continue, as this is not critical for login
-		// log.Printf("failed to delete old sessions for user %s: %v", user.ID, err)
+	if err := a.sessionRepo.DeleteByUserID(ctx, userID); err != nil {
+		// Not critical for login: the old sessions still expire on their own.
+		slog.WarnContext(ctx, "failed to delete old sessions", "user_id", userID, "err", err)
 	}
 
-	accessToken, err := a.tokenGen.GenerateAccessToken(user.ID)
+	familyID := uuid.New()
+	accessToken, err := a.tokenGen.GenerateAccessToken(userID, familyID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	refreshToken, expiresAt, err := a.tokenGen.GenerateRefreshToken()
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	session := &models.Session{
 		RefreshToken: refreshToken,
-		UserID:       user.ID,
+		UserID:       userID,
+		FamilyID:     familyID,
 		ExpiresAt:    expiresAt,
 	}
 
 	if err := a.sessionRepo.Create(ctx, session); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return accessToken, refreshToken.String(), nil
+	return &models.LoginResult{AccessToken: accessToken, RefreshToken: refreshToken.String()}, nil
 }
 
-func (a *authUsecase) Refresh(ctx context.Context, refreshTokenStr string) (string, error) {
+func (a *authUsecase) Refresh(ctx context.Context, refreshTokenStr string) (string, string, error) {
 	refreshToken, err := uuid.Parse(refreshTokenStr)
 	if err != nil {
-		return "", models.ErrInvalidToken
+		return "", "", models.ErrInvalidToken
 	}
 
 	session, err := a.sessionRepo.Find(ctx, refreshToken)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	// A token that was already rotated is being replayed, so either the
+	// legitimate client or an attacker holds a stolen copy. We cannot tell
+	// which, so the whole family is revoked.
+	if session.RotatedAt != nil {
+		return "", "", a.revokeFamily(ctx, session)
 	}
 
 	if session.ExpiresAt.Before(time.Now()) {
 		// Clean up expired session
-		_ = a.sessionRepo.Delete(ctx, refreshToken)
-		return "", models.ErrSessionNotFound
+		if err := a.sessionRepo.Delete(ctx, refreshToken); err != nil {
+			slog.WarnContext(ctx, "failed to delete expired session", "user_id", session.UserID, "err", err)
+		}
+		return "", "", models.ErrSessionNotFound
 	}
 
-	// Sliding window: extend session expiry
-	session.ExpiresAt = time.Now().Add(a.tokenGen.GetRefreshTokenExp())
-	if err := a.sessionRepo.Create(ctx, session); err != nil { // Create will UPSERT
-		return "", err
+	newRefreshToken, _, err := a.tokenGen.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	// The family keeps the expiry it got at login, so that a session cannot
+	// be kept alive indefinitely by refreshing it.
+	next := &models.Session{
+		RefreshToken: newRefreshToken,
+		UserID:       session.UserID,
+		FamilyID:     session.FamilyID,
+		ExpiresAt:    session.ExpiresAt,
+	}
+	if err := a.sessionRepo.Rotate(ctx, session.RefreshToken, next); err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			// Lost a race against another refresh of the same token.
+			return "", "", a.revokeFamily(ctx, session)
+		}
+		return "", "", err
 	}
 
-	newAccessToken, err := a.tokenGen.GenerateAccessToken(session.UserID)
+	newAccessToken, err := a.tokenGen.GenerateAccessToken(session.UserID, session.FamilyID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return newAccessToken, nil
+	return newAccessToken, newRefreshToken.String(), nil
 }
 
-func (a *authUsecase) Logout(ctx context.Context, refreshTokenStr string) error {
+func (a *authUsecase) Logout(ctx context.Context, refreshTokenStr, accessToken string) error {
 	refreshToken, err := uuid.Parse(refreshTokenStr)
 	if err != nil {
 		return models.ErrInvalidToken
 	}
-	return a.sessionRepo.Delete(ctx, refreshToken)
+
+	// Deny the access token too, so logout takes effect immediately rather
+	// than when the token expires. An invalid one has nothing left to revoke.
+	if accessToken != "" {
+		if claims, err := a.tokenGen.ParseAccessToken(accessToken); err == nil {
+			if err := a.denyList.RevokeToken(ctx, claims.TokenID, time.Until(claims.ExpiresAt)); err != nil {
+				return err
+			}
+		}
+	}
+
+	session, err := a.sessionRepo.Find(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, models.ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+	return a.sessionRepo.DeleteByFamilyID(ctx, session.FamilyID)
 }
 
+// revokeFamily deletes every session descending from the same login as
+// session and warns the user. It always returns models.ErrRefreshTokenReused
+// unless the revocation itself fails.
+func (a *authUsecase) revokeFamily(ctx context.Context, session *models.Session) error {
+	if err := a.sessionRepo.DeleteByFamilyID(ctx, session.FamilyID); err != nil {
+		return err
+	}
+	if err := a.RevokeUserTokens(ctx, session.UserID); err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"reason":   "refresh_token_reuse",
+		"familyId": session.FamilyID.String(),
+	})
+	event := &models.Event{
+		ID:          uuid.New(),
+		Type:        models.EventSecurityAlert,
+		Payload:     payload,
+		RecipientID: session.UserID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := a.eventUsecase.StoreEvent(ctx, event); err != nil {
+		return err
+	}
+
+	return models.ErrRefreshTokenReused
+}
+
+func (a *authUsecase) ValidateAccessToken(ctx context.Context, accessToken string) (*util.AccessClaims, error) {
+	claims, err := a.tokenGen.ParseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := a.denyList.IsRevoked(ctx, claims.TokenID, claims.UserID, claims.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, models.ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+func (a *authUsecase) VerifyPassword(ctx context.Context, user *models.User, password, clientIP string) error {
+	if err := a.checkLockout(ctx, user.Username, clientIP); err != nil {
+		return err
+	}
+	if ok, _ := a.passwordHasher.Verify(password, user.PasswordHash); !ok {
+		if err := a.recordLoginFailure(ctx, user.Username, clientIP, user); err != nil {
+			return err
+		}
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (a *authUsecase) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, currentPassword, newPassword, clientIP string) (string, error) {
+	user, err := a.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.VerifyPassword(ctx, user, currentPassword, clientIP); err != nil {
+		return "", err
+	}
+	if err := a.passwordPolicy.Validate(newPassword, user.Username); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := a.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return "", err
+	}
+	if err := a.userRepo.UpdatePasswordHash(ctx, userID, hashedPassword); err != nil {
+		return "", err
+	}
+
+	if err := a.sessionRepo.DeleteByUserIDExcept(ctx, userID, sessionID); err != nil {
+		return "", err
+	}
+	// Outstanding access tokens cannot be told apart by session, so all of
+	// them are revoked and the caller gets a replacement below.
+	if err := a.RevokeUserTokens(ctx, userID); err != nil {
+		return "", err
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"reason": "password_changed",
+	})
+	event := &models.Event{
+		ID:          uuid.New(),
+		Type:        models.EventSecurityAlert,
+		Payload:     payload,
+		RecipientID: userID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := a.eventUsecase.StoreEvent(ctx, event); err != nil {
+		return "", err
+	}
+
+	return a.tokenGen.GenerateAccessToken(userID, sessionID)
+}
+
+func (a *authUsecase) DisableTwoFactor(ctx context.Context, userID uuid.UUID, password, code, clientIP string) error {
+	user, err := a.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return models.ErrTwoFactorNotEnabled
+	}
+
+	// Re-authenticate with both factors: a stolen access token alone must not
+	// be enough to strip the second factor.
+	if err := a.VerifyPassword(ctx, user, password, clientIP); err != nil {
+		return err
+	}
+	if err := a.twoFactorUsecase.VerifyCode(ctx, user, code); err != nil {
+		if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+			if err := a.recordLoginFailure(ctx, user.Username, clientIP, user); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	return a.twoFactorUsecase.Disable(ctx, userID)
+}
+
+// RevokeUserTokens denies every access token issued to the user so far.
+func (a *authUsecase) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return a.denyList.RevokeUserTokens(ctx, userID, time.Now(), a.tokenGen.GetAccessTokenExp())
+}
+
+func (a *authUsecase) JWKS() util.JWKSet {
+	return a.tokenGen.JWKS()
+}
+
+func (a *authUsecase) IssueWsTicket(ctx context.Context, userID uuid.UUID, tokenExpiresAt time.Time) (string, error) {
+	ticket := &models.WsTicket{
+		ID:             uuid.New(),
+		UserID:         userID,
+		TokenExpiresAt: tokenExpiresAt,
+	}
+	if err := a.ticketRepo.Create(ctx, ticket, a.wsTicketTTL); err != nil {
+		return "", err
+	}
+	return ticket.ID.String(), nil
+}
+
+func (a *authUsecase) RedeemWsTicket(ctx context.Context, ticketStr string) (uuid.UUID, time.Time, error) {
+	ticketID, err := uuid.Parse(ticketStr)
+	if err != nil {
+		return uuid.Nil, time.Time{}, models.ErrTicketNotFound
+	}
+
+	ticket, err := a.ticketRepo.Consume(ctx, ticketID)
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+
+	// The ticket cannot outlive the access token it was issued for.
+	if ticket.TokenExpiresAt.Before(time.Now()) {
+		return uuid.Nil, time.Time{}, models.ErrInvalidToken
+	}
+
+	return ticket.UserID, ticket.TokenExpiresAt, nil
+}
@@ -0,0 +1,253 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+// EmailSettings configures the links sent by EmailUsecase.
+type EmailSettings struct {
+	// BaseURL is where the web app is served, e.g. https://chat.example.com.
+	BaseURL         string
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+}
+
+type EmailUsecase interface {
+	// SetEmail mails a verification link to a new address. The account keeps
+	// its current address until the link is opened.
+	SetEmail(ctx context.Context, userID uuid.UUID, email string) error
+	// VerifyEmail makes the address a link was sent to the account's address.
+	// It fails with models.ErrEmailTaken if another account verified it first.
+	VerifyEmail(ctx context.Context, token string) error
+	// RequestPasswordReset mails a reset link when email is the verified
+	// address of an account. It behaves identically whether or not it is.
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type emailUsecase struct {
+	userRepo       repository.UserRepository
+	tokenRepo      repository.EmailTokenRepository
+	sessionRepo    repository.SessionRepository
+	mailer         repository.Mailer
+	passwordHasher util.PasswordHasher
+	passwordPolicy *util.PasswordPolicy
+	authUsecase    AuthUsecase
+	eventUsecase   EventUsecase
+	settings       EmailSettings
+}
+
+func NewEmailUsecase(userRepo repository.UserRepository, tokenRepo repository.EmailTokenRepository, sessionRepo repository.SessionRepository, mailer repository.Mailer, passwordHasher util.PasswordHasher, passwordPolicy *util.PasswordPolicy, authUsecase AuthUsecase, eventUsecase EventUsecase, settings EmailSettings) EmailUsecase {
+	return &emailUsecase{
+		userRepo:       userRepo,
+		tokenRepo:      tokenRepo,
+		sessionRepo:    sessionRepo,
+		mailer:         mailer,
+		passwordHasher: passwordHasher,
+		passwordPolicy: passwordPolicy,
+		authUsecase:    authUsecase,
+		eventUsecase:   eventUsecase,
+		settings:       settings,
+	}
+}
+
+func (u *emailUsecase) SetEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := util.ValidateEmail(email); err != nil {
+		return err
+	}
+
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == email && user.EmailVerified {
+		return nil
+	}
+
+	// The pending address is kept in the token only. Whether another account
+	// already uses it is not checked here, which would reveal that it is
+	// registered; only its owner can open the link and find out.
+	if err := u.tokenRepo.DeleteByUserID(ctx, userID, models.EmailTokenVerifyEmail); err != nil {
+		return err
+	}
+	token, err := u.issueToken(ctx, userID, models.EmailTokenVerifyEmail, email, u.settings.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return u.mailer.Send(ctx, &models.Email{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm this address for your QuikChat account by opening the link below:\n\n%s\n\nThe link expires in %s. If you did not request this, you can ignore this email.\n",
+			user.Username, u.link("/verify-email", token), u.settings.VerificationTTL),
+	})
+}
+
+func (u *emailUsecase) VerifyEmail(ctx context.Context, token string) error {
+	emailToken, err := u.consumeToken(ctx, token, models.EmailTokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	// A newer SetEmail deletes older links, so this is the latest address.
+	return u.userRepo.UpdateEmail(ctx, emailToken.UserID, emailToken.Email, true)
+}
+
+func (u *emailUsecase) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := util.ValidateEmail(email); err != nil {
+		return err
+	}
+
+	// The lookup and delivery happen in the background so that the response
+	// time does not reveal whether the address belongs to an account.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := u.sendPasswordReset(ctx, email); err != nil {
+			slog.ErrorContext(ctx, "failed to send password reset email", "err", err)
+		}
+	}()
+
+	return nil
+}
+
+func (u *emailUsecase) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := u.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	// Never send a reset link to an address the user has not proven to own.
+	if !user.EmailVerified {
+		return nil
+	}
+
+	token, err := u.issueToken(ctx, user.ID, models.EmailTokenPasswordReset, user.Email, u.settings.ResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return u.mailer.Send(ctx, &models.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your QuikChat account. To choose a new password, open the link below:\n\n%s\n\nThe link expires in %s and can be used once. If you did not ask for this, ignore this email and your password will stay the same.\n",
+			user.Username, u.link("/reset-password", token), u.settings.ResetTTL),
+	})
+}
+
+func (u *emailUsecase) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// Validate before consuming so a rejected password does not burn the
+	// link. The username is not known yet, so that rule is skipped here.
+	if err := u.passwordPolicy.Validate(newPassword, ""); err != nil {
+		return err
+	}
+
+	emailToken, err := u.consumeToken(ctx, token, models.EmailTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+
+	user, err := u.userRepo.FindByID(ctx, emailToken.UserID)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(user.Email, emailToken.Email) {
+		return models.ErrEmailTokenInvalid
+	}
+
+	hashedPassword, err := u.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := u.userRepo.UpdatePasswordHash(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Whoever held the account before the reset must lose access.
+	if err := u.tokenRepo.DeleteByUserID(ctx, user.ID, models.EmailTokenPasswordReset); err != nil {
+		return err
+	}
+	if err := u.sessionRepo.DeleteByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := u.authUsecase.RevokeUserTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	// The reset proves control of the account, so a lockout from earlier
+	// failed logins no longer protects anything.
+	if err := u.authUsecase.ClearLockout(ctx, user.Username); err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(map[string]string{
+		"reason": "password_reset",
+	})
+	event := &models.Event{
+		ID:          uuid.New(),
+		Type:        models.EventSecurityAlert,
+		Payload:     payload,
+		RecipientID: user.ID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	return u.eventUsecase.StoreEvent(ctx, event)
+}
+
+// issueToken replaces any outstanding token of the same purpose, so only the
+// most recent link works.
+func (u *emailUsecase) issueToken(ctx context.Context, userID uuid.UUID, purpose models.EmailTokenPurpose, email string, ttl time.Duration) (string, error) {
+	if err := u.tokenRepo.DeleteByUserID(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := util.GenerateEmailToken()
+	if err != nil {
+		return "", err
+	}
+
+	emailToken := &models.EmailToken{
+		TokenHash: util.HashEmailToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := u.tokenRepo.Create(ctx, emailToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (u *emailUsecase) consumeToken(ctx context.Context, token string, purpose models.EmailTokenPurpose) (*models.EmailToken, error) {
+	if token == "" {
+		return nil, models.ErrEmailTokenInvalid
+	}
+	emailToken, err := u.tokenRepo.Consume(ctx, util.HashEmailToken(token), purpose)
+	if err != nil {
+		return nil, err
+	}
+	if emailToken.ExpiresAt.Before(time.Now()) {
+		return nil, models.ErrEmailTokenInvalid
+	}
+	return emailToken, nil
+}
+
+func (u *emailUsecase) link(path, token string) string {
+	return strings.TrimRight(u.settings.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
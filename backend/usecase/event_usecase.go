@@ -2,8 +2,13 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"chat-app/backend/adapter/tracing"
+	"chat-app/backend/adapter/util"
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
 
@@ -14,23 +19,75 @@ type EventUsecase interface {
 	StoreEvent(ctx context.Context, event *models.Event) error
 	GetUndeliveredEvents(ctx context.Context, userID uuid.UUID, cursor time.Time, limit int) ([]*models.Event, error)
 	MarkEventAsDelivered(ctx context.Context, eventID uuid.UUID) error
+	ListMessages(ctx context.Context, userID uuid.UUID) ([]*models.Event, error)
 }
 
+// Durability modes accepted by NewEventUsecase.
+const (
+	// EventDurabilityBuffered appends events to the Redis buffer, from which
+	// the persistence worker stores them. Events fail while Redis is down.
+	EventDurabilityBuffered = "buffered"
+	// EventDurabilitySync stores events in Postgres before returning.
+	EventDurabilitySync = "sync"
+	// EventDurabilityFallback buffers events, storing them in Postgres
+	// directly while Redis is failing.
+	EventDurabilityFallback = "fallback"
+)
+
+// bufferTimeout bounds a write to the Redis buffer, so that an unreachable
+// Redis holds up the hub for no longer than this until the breaker opens.
+const bufferTimeout = time.Second
+
 type eventUsecase struct {
-	redisRepo repository.EventRepository
-	dbRepo    repository.EventRepository
+	redisRepo  repository.EventRepository
+	dbRepo     repository.EventRepository
+	durability string
+	// breaker guards writes to the Redis buffer.
+	breaker *util.CircuitBreaker
 }
 
-func NewEventUsecase(redisRepo, dbRepo repository.EventRepository) EventUsecase {
-	return &eventUsecase{
-		redisRepo: redisRepo,
-		dbRepo:    dbRepo,
+func NewEventUsecase(redisRepo, dbRepo repository.EventRepository, durability string, breaker *util.CircuitBreaker) (EventUsecase, error) {
+	switch durability {
+	case EventDurabilityBuffered, EventDurabilitySync, EventDurabilityFallback:
+	default:
+		return nil, fmt.Errorf("unknown event durability %q", durability)
 	}
+	return &eventUsecase{
+		redisRepo:  redisRepo,
+		dbRepo:     dbRepo,
+		durability: durability,
+		breaker:    breaker,
+	}, nil
 }
 
 func (u *eventUsecase) StoreEvent(ctx context.Context, event *models.Event) error {
-	// All events are buffered in Redis first
-	return u.redisRepo.BufferEvent(ctx, event)
+	if event.TraceContext == nil {
+		event.TraceContext = tracing.Inject(ctx)
+	}
+
+	switch u.durability {
+	case EventDurabilitySync:
+		return u.dbRepo.Store(ctx, event)
+	case EventDurabilityFallback:
+		err := u.bufferEvent(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, util.ErrCircuitOpen) {
+			slog.WarnContext(ctx, "failed to buffer event, storing it directly", "event_id", event.ID, "err", err)
+		}
+		return u.dbRepo.Store(ctx, event)
+	default:
+		return u.bufferEvent(ctx, event)
+	}
+}
+
+func (u *eventUsecase) bufferEvent(ctx context.Context, event *models.Event) error {
+	return u.breaker.Do(func() error {
+		ctx, cancel := context.WithTimeout(ctx, bufferTimeout)
+		defer cancel()
+		return u.redisRepo.BufferEvent(ctx, event)
+	})
 }
 
 func (u *eventUsecase) GetUndeliveredEvents(ctx context.Context, userID uuid.UUID, cursor time.Time, limit int) ([]*models.Event, error) {
@@ -42,3 +99,7 @@ func (u *eventUsecase) MarkEventAsDelivered(ctx context.Context, eventID uuid.UU
 	// Once delivered, remove from durable storage
 	return u.dbRepo.Delete(ctx, eventID)
 }
+
+func (u *eventUsecase) ListMessages(ctx context.Context, userID uuid.UUID) ([]*models.Event, error) {
+	return u.dbRepo.ListMessages(ctx, userID)
+}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"chat-app/backend/models"
@@ -18,18 +19,30 @@ type FriendUsecase interface {
 	Unfriend(ctx context.Context, userID, friendID uuid.UUID) error
 	ListFriends(ctx context.Context, userID uuid.UUID) ([]*models.User, error)
 	ListPendingRequests(ctx context.Context, userID uuid.UUID) ([]*models.User, error)
+	// SuggestFriends lists "people you may know", ranked by mutual friends
+	// and shared groups.
+	SuggestFriends(ctx context.Context, userID uuid.UUID) ([]*models.FriendSuggestion, error)
+	// BlockUser hides the two users from each other's search and suggestions,
+	// ends any friendship or pending request and stops new requests.
+	BlockUser(ctx context.Context, userID uuid.UUID, username string) error
+	UnblockUser(ctx context.Context, userID, blockedID uuid.UUID) error
+	ListBlocked(ctx context.Context, userID uuid.UUID) ([]*models.User, error)
 }
 
+const friendSuggestionLimit = 20
+
 type friendUsecase struct {
 	userRepo     repository.UserRepository
 	friendRepo   repository.FriendshipRepository
+	blockRepo    repository.BlockRepository
 	eventUsecase EventUsecase
 }
 
-func NewFriendUsecase(userRepo repository.UserRepository, friendRepo repository.FriendshipRepository, eventUsecase EventUsecase) FriendUsecase {
+func NewFriendUsecase(userRepo repository.UserRepository, friendRepo repository.FriendshipRepository, blockRepo repository.BlockRepository, eventUsecase EventUsecase) FriendUsecase {
 	return &friendUsecase{
 		userRepo:     userRepo,
 		friendRepo:   friendRepo,
+		blockRepo:    blockRepo,
 		eventUsecase: eventUsecase,
 	}
 }
@@ -48,6 +61,22 @@ func (u *friendUsecase) SendRequest(ctx context.Context, fromUserID uuid.UUID, t
 		return models.ErrCannotFriendSelf
 	}
 
+	blocked, err := u.blockRepo.IsBlocked(ctx, fromUserID, toUser.ID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return models.ErrUserBlocked
+	}
+	// Being blocked looks the same as the user not existing.
+	blockedBy, err := u.blockRepo.IsBlocked(ctx, toUser.ID, fromUserID)
+	if err != nil {
+		return err
+	}
+	if blockedBy {
+		return models.ErrUserNotFound
+	}
+
 	// Check if a friendship or request already exists
 	_, err = u.friendRepo.Find(ctx, fromUserID, toUser.ID)
 	if err == nil {
@@ -192,3 +221,36 @@ func (u *friendUsecase) ListFriends(ctx context.Context, userID uuid.UUID) ([]*m
 func (u *friendUsecase) ListPendingRequests(ctx context.Context, userID uuid.UUID) ([]*models.User, error) {
 	return u.friendRepo.ListByUserID(ctx, userID, models.FriendshipStatusPending)
 }
+
+func (u *friendUsecase) SuggestFriends(ctx context.Context, userID uuid.UUID) ([]*models.FriendSuggestion, error) {
+	return u.friendRepo.ListSuggestions(ctx, userID, friendSuggestionLimit)
+}
+
+func (u *friendUsecase) BlockUser(ctx context.Context, userID uuid.UUID, username string) error {
+	target, err := u.userRepo.FindByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	if target.ID == userID {
+		return models.ErrCannotBlockSelf
+	}
+
+	if err := u.blockRepo.Block(ctx, userID, target.ID); err != nil {
+		return err
+	}
+
+	// The blocked user is not told; the friendship just disappears from
+	// their list the next time it is loaded.
+	if err := u.friendRepo.Delete(ctx, userID, target.ID); err != nil && !errors.Is(err, models.ErrNotFriends) {
+		return err
+	}
+	return nil
+}
+
+func (u *friendUsecase) UnblockUser(ctx context.Context, userID, blockedID uuid.UUID) error {
+	return u.blockRepo.Unblock(ctx, userID, blockedID)
+}
+
+func (u *friendUsecase) ListBlocked(ctx context.Context, userID uuid.UUID) ([]*models.User, error) {
+	return u.blockRepo.ListBlocked(ctx, userID)
+}
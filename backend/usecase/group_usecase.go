@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"mime/multipart"
+	"strings"
 	"time"
 
 	"chat-app/backend/adapter/util"
@@ -15,14 +17,16 @@ import (
 )
 
 type GroupUsecase interface {
-	CreateGroup(ctx context.Context, ownerID uuid.UUID, handle, name string, photo multipart.File, photoHeader *multipart.FileHeader) (*models.Group, error)
+	CreateGroup(ctx context.Context, ownerID uuid.UUID, handle, name string, isPrivate bool, photo multipart.File, photoHeader *multipart.FileHeader) (*models.Group, error)
 	UpdateGroup(ctx context.Context, userID, groupID uuid.UUID, name *string, photo multipart.File, photoHeader *multipart.FileHeader) (*models.Group, error)
 	JoinGroup(ctx context.Context, userID uuid.UUID, groupHandle string) error
 	LeaveGroup(ctx context.Context, userID, groupID uuid.UUID) error
 	AddMember(ctx context.Context, adderID uuid.UUID, newMemberUsername string, groupID uuid.UUID) error
 	RemoveMember(ctx context.Context, ownerID, memberID, groupID uuid.UUID) error
 	TransferOwnership(ctx context.Context, currentOwnerID, newOwnerID, groupID uuid.UUID) error
-	SearchGroups(ctx context.Context, query string) ([]*models.Group, error)
+	SetSlowMode(ctx context.Context, userID, groupID uuid.UUID, seconds int) (*models.Group, error)
+	SetPrivate(ctx context.Context, userID, groupID uuid.UUID, private bool) (*models.Group, error)
+	SearchGroups(ctx context.Context, query string, limit, offset int) ([]*models.Group, error)
 	GetGroupDetails(ctx context.Context, groupID uuid.UUID) (*models.Group, error)
 	ListGroupMembers(ctx context.Context, groupID uuid.UUID) ([]*models.User, error)
 }
@@ -45,7 +49,7 @@ func NewGroupUsecase(groupRepo repository.GroupRepository, userRepo repository.U
 	}
 }
 
-func (u *groupUsecase) CreateGroup(ctx context.Context, ownerID uuid.UUID, handle, name string, photo multipart.File, photoHeader *multipart.FileHeader) (*models.Group, error) {
+func (u *groupUsecase) CreateGroup(ctx context.Context, ownerID uuid.UUID, handle, name string, isPrivate bool, photo multipart.File, photoHeader *multipart.FileHeader) (*models.Group, error) {
 	if err := util.ValidateGroupHandle(handle); err != nil {
 		return nil, err
 	}
@@ -71,6 +75,7 @@ func (u *groupUsecase) CreateGroup(ctx context.Context, ownerID uuid.UUID, handl
 		Name:      name,
 		PhotoURL:  photoURL,
 		OwnerID:   ownerID,
+		IsPrivate: isPrivate,
 		CreatedAt: time.Now(),
 	}
 
@@ -121,6 +126,10 @@ func (u *groupUsecase) JoinGroup(ctx context.Context, userID uuid.UUID, groupHan
 	if err != nil {
 		return err
 	}
+	// Private groups are invitation only and do not admit to existing.
+	if group.IsPrivate {
+		return models.ErrGroupNotFound
+	}
 
 	member := &models.GroupMember{
 		GroupID:  group.ID,
@@ -177,7 +186,9 @@ func (u *groupUsecase) LeaveGroup(ctx context.Context, userID, groupID uuid.UUID
 		oldestMember, err := u.groupRepo.GetOldestMember(ctx, groupID)
 		if err != nil {
 			// This case should be rare, but if it happens, delete the group
-			u.groupRepo.Delete(ctx, groupID)
+			if delErr := u.groupRepo.Delete(ctx, groupID); delErr != nil {
+				slog.ErrorContext(ctx, "failed to delete ownerless group", "group_id", groupID, "err", delErr)
+			}
 			return err
 		}
 		group.OwnerID = oldestMember.ID
@@ -291,8 +302,63 @@ func (u *groupUsecase) TransferOwnership(ctx context.Context, currentOwnerID, ne
 	return u.groupRepo.Update(ctx, group)
 }
 
-func (u *groupUsecase) SearchGroups(ctx context.Context, query string) ([]*models.Group, error) {
-	return u.groupRepo.FuzzySearchByHandle(ctx, query, 10)
+// maxSlowModeSeconds caps slow mode at six hours.
+const maxSlowModeSeconds = 6 * 60 * 60
+
+func (u *groupUsecase) SetSlowMode(ctx context.Context, userID, groupID uuid.UUID, seconds int) (*models.Group, error) {
+	group, err := u.groupRepo.FindByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.OwnerID != userID {
+		return nil, models.ErrNotGroupOwner
+	}
+
+	if seconds < 0 || seconds > maxSlowModeSeconds {
+		return nil, fmt.Errorf("slow mode must be between 0 and %d seconds: %w", maxSlowModeSeconds, models.ErrBadRequest)
+	}
+
+	group.SlowModeSeconds = seconds
+	if err := u.groupRepo.Update(ctx, group); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (u *groupUsecase) SetPrivate(ctx context.Context, userID, groupID uuid.UUID, private bool) (*models.Group, error) {
+	group, err := u.groupRepo.FindByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.OwnerID != userID {
+		return nil, models.ErrNotGroupOwner
+	}
+
+	group.IsPrivate = private
+	if err := u.groupRepo.Update(ctx, group); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+const maxGroupSearchLimit = 50
+
+func (u *groupUsecase) SearchGroups(ctx context.Context, query string, limit, offset int) ([]*models.Group, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []*models.Group{}, nil
+	}
+	if limit <= 0 || limit > maxGroupSearchLimit {
+		limit = maxGroupSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return u.groupRepo.Search(ctx, query, limit, offset)
 }
 
 func (u *groupUsecase) GetGroupDetails(ctx context.Context, groupID uuid.UUID) (*models.Group, error) {
@@ -306,6 +372,7 @@ func (u *groupUsecase) ListGroupMembers(ctx context.Context, groupID uuid.UUID)
 func (u *groupUsecase) notifyGroupMembers(ctx context.Context, groupID, subjectUserID uuid.UUID, eventType models.EventType, payload map[string]interface{}) {
 	members, err := u.groupRepo.ListMembers(ctx, groupID)
 	if err != nil {
+		slog.ErrorContext(ctx, "failed to list group members for notification", "group_id", groupID, "event_type", eventType, "err", err)
 		return
 	}
 
@@ -322,7 +389,9 @@ func (u *groupUsecase) notifyGroupMembers(ctx context.Context, groupID, subjectU
 			RecipientID: member.ID,
 			CreatedAt:   time.Now(),
 		}
-		u.eventUsecase.StoreEvent(ctx, event)
+		if err := u.eventUsecase.StoreEvent(ctx, event); err != nil {
+			slog.ErrorContext(ctx, "failed to store group notification", "group_id", groupID, "recipient_id", member.ID, "event_type", eventType, "err", err)
+		}
 	}
 }
 
@@ -336,6 +405,8 @@ func (u *groupUsecase) notifyUser(ctx context.Context, recipientID, senderID uui
 		SenderID:    &senderID,
 		CreatedAt:   time.Now(),
 	}
-	u.eventUsecase.StoreEvent(ctx, event)
+	if err := u.eventUsecase.StoreEvent(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to store notification", "recipient_id", recipientID, "event_type", eventType, "err", err)
+	}
 }
 
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMessageSearchLimit = 20
+	maxMessageSearchLimit     = 50
+	maxMessageSearchLength    = 200
+)
+
+type SearchUsecase interface {
+	// SearchMessages runs a full-text search over the caller's conversations.
+	// cursor is the NextCursor of the previous page, or empty for the first.
+	SearchMessages(ctx context.Context, userID uuid.UUID, query models.MessageSearchQuery, cursor string) (*models.MessageSearchPage, error)
+}
+
+type searchUsecase struct {
+	messageSearchRepo repository.MessageSearchRepository
+}
+
+func NewSearchUsecase(messageSearchRepo repository.MessageSearchRepository) SearchUsecase {
+	return &searchUsecase{messageSearchRepo: messageSearchRepo}
+}
+
+func (u *searchUsecase) SearchMessages(ctx context.Context, userID uuid.UUID, query models.MessageSearchQuery, cursor string) (*models.MessageSearchPage, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" || len(query.Text) > maxMessageSearchLength {
+		return nil, fmt.Errorf("search query must be between 1 and %d characters: %w", maxMessageSearchLength, models.ErrBadRequest)
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, fmt.Errorf("'from' must be before 'to': %w", models.ErrBadRequest)
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultMessageSearchLimit
+	}
+	if query.Limit > maxMessageSearchLimit {
+		query.Limit = maxMessageSearchLimit
+	}
+
+	if cursor != "" {
+		after, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+	}
+
+	// One extra row tells whether there is another page.
+	limit := query.Limit
+	query.Limit++
+	results, err := u.messageSearchRepo.Search(ctx, userID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.MessageSearchPage{Results: results}
+	if len(results) > limit {
+		page.Results = results[:limit]
+		last := page.Results[limit-1]
+		page.NextCursor = encodeSearchCursor(models.MessageSearchCursor{CreatedAt: last.CreatedAt, EventID: last.EventID})
+	}
+	return page, nil
+}
+
+func encodeSearchCursor(c models.MessageSearchCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeSearchCursor(s string) (*models.MessageSearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", models.ErrBadRequest)
+	}
+	var c models.MessageSearchCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.CreatedAt.IsZero() || c.EventID == uuid.Nil {
+		return nil, fmt.Errorf("invalid cursor: %w", models.ErrBadRequest)
+	}
+	return &c, nil
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"chat-app/backend/adapter/util"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorUsecase interface {
+	BeginEnrollment(ctx context.Context, userID uuid.UUID) (*models.TOTPEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) (recoveryCodes []string, err error)
+	// Disable turns two-factor authentication off. The caller must have
+	// re-authenticated the user; see AuthUsecase.DisableTwoFactor.
+	Disable(ctx context.Context, userID uuid.UUID) error
+	// VerifyCode accepts either a current TOTP code or an unused recovery code.
+	VerifyCode(ctx context.Context, user *models.User, code string) error
+}
+
+type twoFactorUsecase struct {
+	userRepo     repository.UserRepository
+	recoveryRepo repository.RecoveryCodeRepository
+	issuer       string
+}
+
+func NewTwoFactorUsecase(userRepo repository.UserRepository, recoveryRepo repository.RecoveryCodeRepository, issuer string) TwoFactorUsecase {
+	return &twoFactorUsecase{
+		userRepo:     userRepo,
+		recoveryRepo: recoveryRepo,
+		issuer:       issuer,
+	}
+}
+
+func (u *twoFactorUsecase) BeginEnrollment(ctx context.Context, userID uuid.UUID) (*models.TOTPEnrollment, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, models.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret is stored disabled until the user proves their authenticator
+	// produces matching codes.
+	if err := u.userRepo.UpdateTOTP(ctx, userID, secret, false); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: util.TOTPProvisioningURI(u.issuer, user.Username, secret),
+	}, nil
+}
+
+func (u *twoFactorUsecase) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, models.ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, models.ErrTwoFactorNotEnabled
+	}
+
+	if _, ok := util.ValidateTOTP(user.TOTPSecret, code, time.Now()); !ok {
+		return nil, models.ErrInvalidTwoFactorCode
+	}
+
+	recoveryCodes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(recoveryCodes))
+	for i, rc := range recoveryCodes {
+		hashes[i] = util.HashRecoveryCode(rc)
+	}
+	if err := u.recoveryRepo.ReplaceAll(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	if err := u.userRepo.UpdateTOTP(ctx, userID, user.TOTPSecret, true); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (u *twoFactorUsecase) Disable(ctx context.Context, userID uuid.UUID) error {
+	if err := u.userRepo.UpdateTOTP(ctx, userID, "", false); err != nil {
+		return err
+	}
+	return u.recoveryRepo.DeleteByUserID(ctx, userID)
+}
+
+func (u *twoFactorUsecase) VerifyCode(ctx context.Context, user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return models.ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := util.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := u.userRepo.MarkTOTPStepUsed(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return models.ErrInvalidTwoFactorCode // Replayed code
+		}
+		return nil
+	}
+
+	return u.recoveryRepo.Consume(ctx, user.ID, util.HashRecoveryCode(code))
+}
@@ -1,32 +1,73 @@
 package usecase
 
 import (
+	"archive/zip"
 	"chat-app/backend/adapter/util"
 	"chat-app/backend/models"
 	"chat-app/backend/repository"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"log/slog"
 	"mime/multipart"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const userSearchLimit = 20
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as
+// they are.
+type ProfileUpdate struct {
+	Username           *string
+	DisplayName        *string
+	Bio                *string
+	LastSeenVisibility *models.LastSeenVisibility
+}
+
 type UserUsecase interface {
 	Register(ctx context.Context, username, password string) (*models.User, error)
-	GetByUsername(ctx context.Context, username string) (*models.User, error)
-	UpdateProfile(ctx context.Context, userID uuid.UUID, username, password *string, profilePic multipart.File, profilePicHeader *multipart.FileHeader) (*models.User, error)
+	SearchUsers(ctx context.Context, viewerID uuid.UUID, query string) ([]*models.User, error)
+	// GetByUsername returns the profile as viewerID may see it.
+	GetByUsername(ctx context.Context, viewerID uuid.UUID, username string) (*models.User, error)
+	UpdateProfile(ctx context.Context, userID uuid.UUID, update ProfileUpdate, profilePic multipart.File, profilePicHeader *multipart.FileHeader) (*models.User, error)
+	// SetStatus sets the custom status, which disappears at expiresAt if it is
+	// set. An empty text and emoji clear it.
+	SetStatus(ctx context.Context, userID uuid.UUID, text, emoji string, expiresAt *time.Time) (*models.User, error)
+	// TouchLastSeen records that the user is or was just online.
+	TouchLastSeen(ctx context.Context, userID uuid.UUID) error
+	DeleteAccount(ctx context.Context, userID uuid.UUID, password, clientIP string) error
+	// ExportData writes a ZIP archive of everything stored about the user.
+	ExportData(ctx context.Context, userID uuid.UUID, w io.Writer) error
 }
 
 type userUsecase struct {
-	userRepo repository.UserRepository
-	fileRepo repository.FileRepository
+	userRepo       repository.UserRepository
+	friendRepo     repository.FriendshipRepository
+	groupRepo      repository.GroupRepository
+	fileRepo       repository.FileRepository
+	passwordHasher util.PasswordHasher
+	passwordPolicy *util.PasswordPolicy
+	authUsecase    AuthUsecase
+	groupUsecase   GroupUsecase
+	eventUsecase   EventUsecase
 }
 
-func NewUserUsecase(userRepo repository.UserRepository, fileRepo repository.FileRepository) UserUsecase {
+func NewUserUsecase(userRepo repository.UserRepository, friendRepo repository.FriendshipRepository, groupRepo repository.GroupRepository, fileRepo repository.FileRepository, passwordHasher util.PasswordHasher, passwordPolicy *util.PasswordPolicy, authUsecase AuthUsecase, groupUsecase GroupUsecase, eventUsecase EventUsecase) UserUsecase {
 	return &userUsecase{
-		userRepo: userRepo,
-		fileRepo: fileRepo,
+		userRepo:       userRepo,
+		friendRepo:     friendRepo,
+		groupRepo:      groupRepo,
+		fileRepo:       fileRepo,
+		passwordHasher: passwordHasher,
+		passwordPolicy: passwordPolicy,
+		authUsecase:    authUsecase,
+		groupUsecase:   groupUsecase,
+		eventUsecase:   eventUsecase,
 	}
 }
 
@@ -34,7 +75,7 @@ func (u *userUsecase) Register(ctx context.Context, username, password string) (
 	if err := util.ValidateUsername(username); err != nil {
 		return nil, err
 	}
-	if err := util.ValidatePassword(password); err != nil {
+	if err := u.passwordPolicy.Validate(password, username); err != nil {
 		return nil, err
 	}
 
@@ -46,7 +87,7 @@ func (u *userUsecase) Register(ctx context.Context, username, password string) (
 		return nil, models.ErrUsernameTaken
 	}
 
-	hashedPassword, err := util.HashPassword(password)
+	hashedPassword, err := u.passwordHasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
@@ -64,40 +105,98 @@ func (u *userUsecase) Register(ctx context.Context, username, password string) (
 	return user, nil
 }
 
-func (u *userUsecase) GetByUsername(ctx context.Context, username string) (*models.User, error) {
-	return u.userRepo.FindByUsername(ctx, username)
+func (u *userUsecase) SearchUsers(ctx context.Context, viewerID uuid.UUID, query string) ([]*models.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []*models.User{}, nil
+	}
+	return u.userRepo.Search(ctx, viewerID, query, userSearchLimit)
 }
 
-func (u *userUsecase) UpdateProfile(ctx context.Context, userID uuid.UUID, username, password *string, profilePic multipart.File, profilePicHeader *multipart.FileHeader) (*models.User, error) {
+func (u *userUsecase) GetByUsername(ctx context.Context, viewerID uuid.UUID, username string) (*models.User, error) {
+	user, err := u.userRepo.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Status != nil && user.Status.Expired(time.Now()) {
+		user.Status = nil
+	}
+	if user.ID == viewerID {
+		return user, nil
+	}
+
+	visible, err := u.lastSeenVisibleTo(ctx, user, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		user.LastSeenAt = nil
+	}
+	user.LastSeenVisibility = ""
+	return user, nil
+}
+
+func (u *userUsecase) lastSeenVisibleTo(ctx context.Context, user *models.User, viewerID uuid.UUID) (bool, error) {
+	switch user.LastSeenVisibility {
+	case models.LastSeenEveryone:
+		return true, nil
+	case models.LastSeenFriends:
+		friendship, err := u.friendRepo.Find(ctx, user.ID, viewerID)
+		if err != nil {
+			if errors.Is(err, models.ErrFriendRequestNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return friendship.Status == models.FriendshipStatusAccepted, nil
+	default:
+		return false, nil
+	}
+}
+
+func (u *userUsecase) UpdateProfile(ctx context.Context, userID uuid.UUID, update ProfileUpdate, profilePic multipart.File, profilePicHeader *multipart.FileHeader) (*models.User, error) {
 	user, err := u.userRepo.FindByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if username != nil {
-		if err := util.ValidateUsername(*username); err != nil {
+	if update.Username != nil {
+		if err := util.ValidateUsername(*update.Username); err != nil {
 			return nil, err
 		}
 		// Check if new username is taken by another user
-		existingUser, err := u.userRepo.FindByUsername(ctx, *username)
+		existingUser, err := u.userRepo.FindByUsername(ctx, *update.Username)
 		if err != nil && !errors.Is(err, models.ErrUserNotFound) {
 			return nil, err
 		}
 		if existingUser != nil && existingUser.ID != userID {
 			return nil, models.ErrUsernameTaken
 		}
-		user.Username = strings.ToLower(*username)
+		user.Username = strings.ToLower(*update.Username)
 	}
 
-	if password != nil {
-		if err := util.ValidatePassword(*password); err != nil {
+	if update.DisplayName != nil {
+		displayName := strings.TrimSpace(*update.DisplayName)
+		if err := util.ValidateDisplayName(displayName); err != nil {
 			return nil, err
 		}
-		hashedPassword, err := util.HashPassword(*password)
-		if err != nil {
+		user.DisplayName = displayName
+	}
+
+	if update.Bio != nil {
+		bio := strings.TrimSpace(*update.Bio)
+		if err := util.ValidateBio(bio); err != nil {
+			return nil, err
+		}
+		user.Bio = bio
+	}
+
+	if update.LastSeenVisibility != nil {
+		if err := util.ValidateLastSeenVisibility(*update.LastSeenVisibility); err != nil {
 			return nil, err
 		}
-		user.PasswordHash = hashedPassword
+		user.LastSeenVisibility = *update.LastSeenVisibility
 	}
 
 	if profilePic != nil {
@@ -118,3 +217,182 @@ func (u *userUsecase) UpdateProfile(ctx context.Context, userID uuid.UUID, usern
 	return user, nil
 }
 
+func (u *userUsecase) SetStatus(ctx context.Context, userID uuid.UUID, text, emoji string, expiresAt *time.Time) (*models.User, error) {
+	text = strings.TrimSpace(text)
+	emoji = strings.TrimSpace(emoji)
+	if err := util.ValidateStatus(text, emoji); err != nil {
+		return nil, err
+	}
+
+	var status *models.UserStatus
+	if text != "" || emoji != "" {
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return nil, &models.ProfileValidationError{Reason: "status expiry must be in the future"}
+		}
+		status = &models.UserStatus{Text: text, Emoji: emoji, ExpiresAt: expiresAt}
+	}
+	if err := u.userRepo.UpdateStatus(ctx, userID, status); err != nil {
+		return nil, err
+	}
+
+	return u.userRepo.FindByID(ctx, userID)
+}
+
+func (u *userUsecase) TouchLastSeen(ctx context.Context, userID uuid.UUID) error {
+	return u.userRepo.UpdateLastSeen(ctx, userID, time.Now().UTC())
+}
+
+func (u *userUsecase) DeleteAccount(ctx context.Context, userID uuid.UUID, password, clientIP string) error {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.authUsecase.VerifyPassword(ctx, user, password, clientIP); err != nil {
+		return err
+	}
+
+	// Leave every group first so that owned groups are handed to their oldest
+	// remaining member (or deleted if empty) rather than left without an owner.
+	// A group may be deleted while it is being left, for instance when no new
+	// owner can be found; that counts as left. Groups left by an earlier
+	// attempt are no longer listed, so a retry picks up where it failed.
+	groups, err := u.groupRepo.ListByMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		err := u.groupUsecase.LeaveGroup(ctx, userID, group.ID)
+		if err != nil && !errors.Is(err, models.ErrNotGroupMember) && !errors.Is(err, models.ErrGroupNotFound) {
+			return err
+		}
+	}
+
+	// Revoke first: once the row is gone a failure here could not be retried,
+	// and the access tokens would stay valid until they expire.
+	if err := u.authUsecase.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	// Sessions, friendships and recovery codes cascade with the user row.
+	if err := u.userRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	if user.ProfilePicURL != "" {
+		if err := u.fileRepo.Delete(user.ProfilePicURL); err != nil {
+			// The account is already gone; an orphaned file is not worth failing for.
+			slog.WarnContext(ctx, "failed to delete profile picture", "user_id", userID, "err", err)
+		}
+	}
+
+	return nil
+}
+
+// exportProfile includes the account settings that models.User keeps out of
+// its JSON representation.
+type exportProfile struct {
+	ID                 uuid.UUID                 `json:"id"`
+	Username           string                    `json:"username"`
+	DisplayName        string                    `json:"displayName"`
+	Bio                string                    `json:"bio"`
+	Status             *models.UserStatus        `json:"status,omitempty"`
+	LastSeenAt         *time.Time                `json:"lastSeenAt,omitempty"`
+	LastSeenVisibility models.LastSeenVisibility `json:"lastSeenVisibility"`
+	ProfilePicURL      string                    `json:"profilePicUrl"`
+	Email              string                    `json:"email,omitempty"`
+	EmailVerified      bool                      `json:"emailVerified"`
+	TwoFactorEnabled   bool                      `json:"twoFactorEnabled"`
+	CreatedAt          time.Time                 `json:"createdAt"`
+}
+
+type exportFriends struct {
+	Friends         []*models.User `json:"friends"`
+	PendingRequests []*models.User `json:"pendingRequests"`
+}
+
+func (u *userUsecase) ExportData(ctx context.Context, userID uuid.UUID, w io.Writer) error {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	friends, err := u.friendRepo.ListByUserID(ctx, userID, models.FriendshipStatusAccepted)
+	if err != nil {
+		return err
+	}
+	pending, err := u.friendRepo.ListByUserID(ctx, userID, models.FriendshipStatusPending)
+	if err != nil {
+		return err
+	}
+	groups, err := u.groupRepo.ListByMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+	messages, err := u.eventUsecase.ListMessages(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if messages == nil {
+		messages = []*models.Event{}
+	}
+
+	zw := zip.NewWriter(w)
+
+	documents := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", exportProfile{
+			ID:                 user.ID,
+			Username:           user.Username,
+			DisplayName:        user.DisplayName,
+			Bio:                user.Bio,
+			Status:             user.Status,
+			LastSeenAt:         user.LastSeenAt,
+			LastSeenVisibility: user.LastSeenVisibility,
+			ProfilePicURL:      user.ProfilePicURL,
+			Email:              user.Email,
+			EmailVerified:      user.EmailVerified,
+			TwoFactorEnabled:   user.TOTPEnabled,
+			CreatedAt:          user.CreatedAt,
+		}},
+		{"friends.json", exportFriends{Friends: friends, PendingRequests: pending}},
+		{"groups.json", groups},
+		{"messages.json", messages},
+	}
+	for _, doc := range documents {
+		f, err := zw.Create(doc.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc.data); err != nil {
+			return err
+		}
+	}
+
+	if user.ProfilePicURL != "" {
+		if err := u.exportFile(zw, "files/"+path.Base(user.ProfilePicURL), user.ProfilePicURL); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (u *userUsecase) exportFile(zw *zip.Writer, name, fileURL string) error {
+	src, err := u.fileRepo.Open(fileURL)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
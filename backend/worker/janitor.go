@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-app/backend/adapter/metrics"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+)
+
+const (
+	// batchPause separates delete batches so that each holds its locks only
+	// briefly and other writers get through in between.
+	batchPause = 100 * time.Millisecond
+	// partitionsAhead is how many monthly partitions, counting the current
+	// one, are kept in place ahead of the events that will fill them.
+	partitionsAhead = 3
+)
+
+// RetentionPolicy is how long events are kept. A zero duration keeps events
+// forever.
+type RetentionPolicy struct {
+	// ByType overrides Default for individual event types.
+	ByType  map[models.EventType]time.Duration
+	Default time.Duration
+}
+
+// ParseRetention builds a policy from "type=days" entries and a default
+// number of days.
+func ParseRetention(entries []string, defaultDays int) (RetentionPolicy, error) {
+	if defaultDays < 0 {
+		return RetentionPolicy{}, fmt.Errorf("invalid default retention %d days", defaultDays)
+	}
+	policy := RetentionPolicy{
+		ByType:  make(map[models.EventType]time.Duration, len(entries)),
+		Default: time.Duration(defaultDays) * 24 * time.Hour,
+	}
+	for _, entry := range entries {
+		eventType, daysStr, ok := strings.Cut(entry, "=")
+		days, err := strconv.Atoi(strings.TrimSpace(daysStr))
+		if !ok || err != nil || days < 0 || strings.TrimSpace(eventType) == "" {
+			return RetentionPolicy{}, fmt.Errorf("invalid retention %q, want type=days", entry)
+		}
+		policy.ByType[models.EventType(strings.TrimSpace(eventType))] = time.Duration(days) * 24 * time.Hour
+	}
+	return policy, nil
+}
+
+// longest returns how long the oldest kept event is kept, and false if some
+// events are kept forever.
+func (p RetentionPolicy) longest() (time.Duration, bool) {
+	if p.Default == 0 {
+		return 0, false
+	}
+	longest := p.Default
+	for _, d := range p.ByType {
+		if d == 0 {
+			return 0, false
+		}
+		longest = max(longest, d)
+	}
+	return longest, true
+}
+
+// JanitorSettings tune a Janitor.
+type JanitorSettings struct {
+	// Interval is how long the janitor waits between runs.
+	Interval time.Duration
+	// BatchSize is how many rows a single delete removes.
+	BatchSize int
+	Retention RetentionPolicy
+	// Partitioned is set once events has been partitioned by month, which
+	// lets the janitor drop whole months and requires it to create new ones.
+	Partitioned bool
+}
+
+// Janitor deletes events past their retention and expired sessions.
+type Janitor struct {
+	events     repository.EventRepository
+	sessions   repository.SessionRepository
+	partitions repository.EventPartitionRepository
+	settings   JanitorSettings
+}
+
+// NewJanitor returns a Janitor. partitions is only used when
+// settings.Partitioned is set.
+func NewJanitor(events repository.EventRepository, sessions repository.SessionRepository, partitions repository.EventPartitionRepository, settings JanitorSettings) *Janitor {
+	return &Janitor{
+		events:     events,
+		sessions:   sessions,
+		partitions: partitions,
+		settings:   settings,
+	}
+}
+
+// Run cleans up straight away and then every Interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.settings.Interval)
+	defer ticker.Stop()
+	for {
+		if err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "janitor run failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs every cleanup task once. A failing task does not stop
+// the others; their errors are joined.
+func (j *Janitor) RunOnce(ctx context.Context) error {
+	now := time.Now()
+	var errs []error
+	if j.settings.Partitioned {
+		errs = append(errs, j.maintainPartitions(ctx, now))
+	}
+	errs = append(errs, j.purgeEvents(ctx, now))
+	errs = append(errs, j.purge(ctx, "sessions", func(ctx context.Context) (int64, error) {
+		return j.sessions.DeleteExpired(ctx, now, j.settings.BatchSize)
+	}))
+	return errors.Join(errs...)
+}
+
+// maintainPartitions creates the partitions that upcoming events go into
+// and drops months in which every event has expired.
+func (j *Janitor) maintainPartitions(ctx context.Context, now time.Time) error {
+	if err := j.partitions.EnsurePartitions(ctx, now, partitionsAhead); err != nil {
+		return err
+	}
+	longest, ok := j.settings.Retention.longest()
+	if !ok {
+		return nil
+	}
+	dropped, err := j.partitions.DropPartitionsBefore(ctx, now.Add(-longest))
+	for _, name := range dropped {
+		slog.InfoContext(ctx, "dropped expired event partition", "partition", name)
+	}
+	return err
+}
+
+func (j *Janitor) purgeEvents(ctx context.Context, now time.Time) error {
+	var errs []error
+	overridden := make([]models.EventType, 0, len(j.settings.Retention.ByType))
+	for eventType, retention := range j.settings.Retention.ByType {
+		overridden = append(overridden, eventType)
+		if retention == 0 {
+			continue
+		}
+		errs = append(errs, j.purge(ctx, "events", func(ctx context.Context) (int64, error) {
+			return j.events.DeleteTypeBefore(ctx, eventType, now.Add(-retention), j.settings.BatchSize)
+		}))
+	}
+	if retention := j.settings.Retention.Default; retention > 0 {
+		errs = append(errs, j.purge(ctx, "events", func(ctx context.Context) (int64, error) {
+			return j.events.DeleteBeforeExcept(ctx, now.Add(-retention), overridden, j.settings.BatchSize)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// purge calls deleteBatch until it deletes less than a full batch, pausing
+// between batches.
+func (j *Janitor) purge(ctx context.Context, table string, deleteBatch func(context.Context) (int64, error)) error {
+	var total int64
+	defer func() {
+		if total > 0 {
+			slog.InfoContext(ctx, "purged expired rows", "table", table, "rows", total)
+		}
+	}()
+	for {
+		n, err := deleteBatch(ctx)
+		total += n
+		metrics.JanitorDeletedRows.WithLabelValues(table).Add(float64(n))
+		if err != nil {
+			return fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+		if n < int64(j.settings.BatchSize) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(batchPause):
+		}
+	}
+}
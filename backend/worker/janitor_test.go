@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+)
+
+const day = 24 * time.Hour
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		defaultDays int
+		want        RetentionPolicy
+		wantErr     bool
+	}{
+		{
+			name:        "default only",
+			defaultDays: 30,
+			want:        RetentionPolicy{ByType: map[models.EventType]time.Duration{}, Default: 30 * day},
+		},
+		{
+			name:    "overrides",
+			entries: []string{"message_ack=7", " typing = 0 "},
+			want: RetentionPolicy{ByType: map[models.EventType]time.Duration{
+				"message_ack": 7 * day,
+				"typing":      0,
+			}},
+		},
+		{name: "negative default", defaultDays: -1, wantErr: true},
+		{name: "missing separator", entries: []string{"message_ack"}, wantErr: true},
+		{name: "non-numeric days", entries: []string{"message_ack=week"}, wantErr: true},
+		{name: "negative days", entries: []string{"message_ack=-1"}, wantErr: true},
+		{name: "empty type", entries: []string{" =7"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.entries, tt.defaultDays)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRetention = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRetention: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRetention = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyLongest(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   time.Duration
+		wantOK bool
+	}{
+		{"default kept forever", RetentionPolicy{ByType: map[models.EventType]time.Duration{"a": day}}, 0, false},
+		{"type kept forever", RetentionPolicy{ByType: map[models.EventType]time.Duration{"a": 0}, Default: day}, 0, false},
+		{"default longest", RetentionPolicy{ByType: map[models.EventType]time.Duration{"a": day}, Default: 30 * day}, 30 * day, true},
+		{"override longest", RetentionPolicy{ByType: map[models.EventType]time.Duration{"a": 90 * day}, Default: 30 * day}, 90 * day, true},
+	}
+	for _, tt := range tests {
+		got, ok := tt.policy.longest()
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: longest = (%v, %t), want (%v, %t)", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+type fakeEventRepo struct {
+	repository.EventRepository
+	typeBatches []int64
+	typeCalls   int
+	exceptCalls int
+	except      []models.EventType
+}
+
+func (f *fakeEventRepo) DeleteTypeBefore(ctx context.Context, eventType models.EventType, cutoff time.Time, limit int) (int64, error) {
+	n := f.typeBatches[f.typeCalls]
+	f.typeCalls++
+	return n, nil
+}
+
+func (f *fakeEventRepo) DeleteBeforeExcept(ctx context.Context, cutoff time.Time, except []models.EventType, limit int) (int64, error) {
+	f.exceptCalls++
+	f.except = except
+	return 0, nil
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	err   error
+	calls int
+}
+
+func (f *fakeSessionRepo) DeleteExpired(ctx context.Context, now time.Time, limit int) (int64, error) {
+	f.calls++
+	return 0, f.err
+}
+
+func TestJanitorRunOnce(t *testing.T) {
+	retention, err := ParseRetention([]string{"message_ack=7", "typing=0"}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A full first batch makes the janitor go back for another.
+	events := &fakeEventRepo{typeBatches: []int64{10, 3}}
+	sessions := &fakeSessionRepo{err: errors.New("connection reset")}
+	janitor := NewJanitor(events, sessions, nil, JanitorSettings{Interval: time.Hour, BatchSize: 10, Retention: retention})
+
+	if err := janitor.RunOnce(context.Background()); err == nil {
+		t.Error("RunOnce = nil, want the sessions error")
+	}
+	if events.typeCalls != 2 {
+		t.Errorf("DeleteTypeBefore called %d times, want 2", events.typeCalls)
+	}
+	if events.exceptCalls != 1 || len(events.except) != 2 {
+		t.Errorf("DeleteBeforeExcept called %d times excluding %v, want once excluding both overridden types", events.exceptCalls, events.except)
+	}
+	if sessions.calls != 1 {
+		t.Errorf("DeleteExpired called %d times, want 1", sessions.calls)
+	}
+}
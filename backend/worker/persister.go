@@ -0,0 +1,202 @@
+// Package worker runs background jobs: moving events from the Redis buffer
+// to Postgres and cleaning up expired rows.
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"chat-app/backend/adapter/health"
+	"chat-app/backend/adapter/metrics"
+	"chat-app/backend/adapter/tracing"
+	"chat-app/backend/models"
+	"chat-app/backend/repository"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("chat-app/backend/worker")
+
+// flushTimeout bounds a single batch.
+const flushTimeout = 30 * time.Second
+
+// Settings tune a Persister.
+type Settings struct {
+	// Interval is how long to wait before looking again once the buffer
+	// holds less than a full batch.
+	Interval time.Duration
+	// BatchSize is how many events are read and stored at a time.
+	BatchSize int
+	// MaxBackoff caps the wait after consecutive failures, which starts at
+	// Interval and doubles with each failure.
+	MaxBackoff time.Duration
+}
+
+// Persister stores buffered events in Postgres and removes them from the
+// buffer. Any number of persisters may run against the same buffer; each
+// event is handed to one of them.
+type Persister struct {
+	buffer    repository.EventRepository
+	store     repository.EventRepository
+	settings  Settings
+	heartbeat *health.Heartbeat
+}
+
+// NewPersister returns a Persister moving events from buffer to store.
+func NewPersister(buffer, store repository.EventRepository, settings Settings) *Persister {
+	return &Persister{
+		buffer:    buffer,
+		store:     store,
+		settings:  settings,
+		heartbeat: health.NewHeartbeat(),
+	}
+}
+
+// Run flushes the buffer until ctx is done, starting straight away in case
+// a previous process left a backlog. A full batch means more events are
+// waiting, so the next one is flushed at once; otherwise Run waits for
+// Interval. A batch in progress when ctx is done is completed.
+func (p *Persister) Run(ctx context.Context) {
+	backoff := p.settings.Interval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		n, err := p.flushWithTimeout(context.WithoutCancel(ctx))
+		switch {
+		case err != nil:
+			timer.Reset(backoff)
+			backoff = min(backoff*2, p.settings.MaxBackoff)
+		case n == p.settings.BatchSize:
+			backoff = p.settings.Interval
+			timer.Reset(0)
+		default:
+			backoff = p.settings.Interval
+			timer.Reset(p.settings.Interval)
+		}
+	}
+}
+
+// Drain flushes batches until the buffer is empty, a batch fails or ctx is
+// done. It is meant for shutdown, once nothing adds to the buffer.
+func (p *Persister) Drain(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := p.flush(ctx)
+		if err != nil {
+			return err
+		}
+		if n < p.settings.BatchSize {
+			return nil
+		}
+	}
+}
+
+// Check fails once no batch has succeeded for three intervals.
+func (p *Persister) Check(ctx context.Context) error {
+	return p.heartbeat.Check(3 * p.settings.Interval)(ctx)
+}
+
+func (p *Persister) flushWithTimeout(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+	defer cancel()
+	return p.flush(ctx)
+}
+
+// flush moves one batch and returns how many events it read. The span
+// links to the traces that produced the events.
+func (p *Persister) flush(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "events flush")
+	defer span.End()
+
+	n, err := p.flushBatch(ctx, span)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return n, err
+	}
+	p.heartbeat.Beat()
+	if depth, err := p.buffer.CountBufferedEvents(ctx); err == nil {
+		metrics.EventBufferDepth.Set(float64(depth))
+	}
+	return n, nil
+}
+
+func (p *Persister) flushBatch(ctx context.Context, span trace.Span) (int, error) {
+	events, err := p.buffer.GetBufferedEvents(ctx, p.settings.BatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to read buffered events", "err", err)
+		metrics.EventFlushFailures.WithLabelValues(metrics.FlushStageRead).Inc()
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int("events.batch_size", len(events)))
+	if len(events) == 0 {
+		return 0, nil
+	}
+	for _, event := range events {
+		if sc := trace.SpanContextFromContext(tracing.Extract(ctx, event.TraceContext)); sc.IsValid() {
+			span.AddLink(trace.Link{SpanContext: sc})
+		}
+	}
+	metrics.EventFlushBatchSize.Observe(float64(len(events)))
+
+	stored := events
+	if err := p.store.StoreBatch(ctx, events); err != nil {
+		if !errors.Is(err, models.ErrInvalidEvent) {
+			slog.ErrorContext(ctx, "failed to store event batch", "count", len(events), "err", err)
+			metrics.EventFlushFailures.WithLabelValues(metrics.FlushStageStore).Inc()
+			return len(events), err
+		}
+		// One bad event fails the whole batch, so find it by storing the
+		// events one at a time.
+		stored, err = p.storeEach(ctx, events)
+		if err != nil {
+			return len(events), err
+		}
+	}
+
+	if err := p.buffer.DeleteBufferedEvents(ctx, stored); err != nil {
+		slog.ErrorContext(ctx, "failed to delete buffered events", "count", len(stored), "err", err)
+		metrics.EventFlushFailures.WithLabelValues(metrics.FlushStageDelete).Inc()
+		return len(events), err
+	}
+	return len(events), nil
+}
+
+// storeEach stores events one at a time, dead-lettering those Postgres
+// rejects, and returns the ones stored. Events stored before a failure are
+// stored again with the next attempt, which skips them.
+func (p *Persister) storeEach(ctx context.Context, events []*models.Event) ([]*models.Event, error) {
+	stored := make([]*models.Event, 0, len(events))
+	for _, event := range events {
+		err := p.store.Store(ctx, event)
+		if err == nil {
+			stored = append(stored, event)
+			continue
+		}
+		if !errors.Is(err, models.ErrInvalidEvent) {
+			slog.ErrorContext(ctx, "failed to store event", "event_id", event.ID, "err", err)
+			metrics.EventFlushFailures.WithLabelValues(metrics.FlushStageStore).Inc()
+			return nil, err
+		}
+
+		slog.WarnContext(ctx, "dead-lettering event", "event_id", event.ID, "event_type", event.Type, "err", err)
+		if err := p.buffer.DeadLetterBufferedEvent(ctx, event, err.Error()); err != nil {
+			slog.ErrorContext(ctx, "failed to dead-letter event", "event_id", event.ID, "err", err)
+			metrics.EventFlushFailures.WithLabelValues(metrics.FlushStageDeadLetter).Inc()
+			return nil, err
+		}
+		metrics.EventsDeadLettered.Inc()
+	}
+	return stored, nil
+}
@@ -2,6 +2,13 @@ import { getState, setState } from './state.js';
 
 const BASE_URL = '/api/v1';
 
+// When the server delivers the refresh token as an HttpOnly cookie it also
+// sets a readable csrf_token cookie that must be echoed in X-CSRF-Token.
+function csrfHeaders() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]+)/);
+    return match ? { 'X-CSRF-Token': decodeURIComponent(match[1]) } : {};
+}
+
 async function request(endpoint, options = {}) {
     const { accessToken } = getState();
     const headers = {
@@ -37,6 +44,10 @@ export const api = {
         method: 'POST',
         body: JSON.stringify({ username, password }),
     }),
+    loginTwoFactor: (challengeToken, code) => request('/login/2fa', {
+        method: 'POST',
+        body: JSON.stringify({ challengeToken, code }),
+    }),
     register: (username, password) => request('/register', {
         method: 'POST',
         body: JSON.stringify({ username, password }),
@@ -45,7 +56,53 @@ export const api = {
         method: 'POST',
         body: JSON.stringify({ refreshToken }),
     }),
+    // Without a refresh token in state it lives in the HttpOnly cookie.
+    refresh: (refreshToken) => request('/refresh', {
+        method: 'POST',
+        headers: csrfHeaders(),
+        body: refreshToken ? JSON.stringify({ refreshToken }) : undefined,
+    }),
+    logoutWithCookie: () => request('/refresh', {
+        method: 'DELETE',
+        headers: csrfHeaders(),
+    }),
+    setStatus: (text, emoji, expiresAt) => request('/me/status', {
+        method: 'PUT',
+        body: JSON.stringify({ text, emoji, expiresAt }),
+    }),
+    clearStatus: () => request('/me/status', { method: 'DELETE' }),
+    forgotPassword: (email) => request('/password/forgot', {
+        method: 'POST',
+        body: JSON.stringify({ email }),
+    }),
+    resetPassword: (token, newPassword) => request('/password/reset', {
+        method: 'POST',
+        body: JSON.stringify({ token, newPassword }),
+    }),
+    verifyEmail: (token) => request('/email/verify', {
+        method: 'POST',
+        body: JSON.stringify({ token }),
+    }),
+    setEmail: (email) => request('/me/email', {
+        method: 'PUT',
+        body: JSON.stringify({ email }),
+    }),
+    getWsTicket: () => request('/ws/ticket', { method: 'POST' }),
+    // Signs out other sessions; the response carries a new access token.
+    changePassword: (currentPassword, newPassword) => request('/me/password', {
+        method: 'POST',
+        body: JSON.stringify({ currentPassword, newPassword }),
+    }),
     getFriends: () => request('/friends'),
+    getFriendSuggestions: () => request('/friends/suggestions'),
+    searchGroups: (query, offset = 0) => request(`/groups/search?q=${encodeURIComponent(query)}&offset=${offset}`),
+    searchMessages: (query, cursor = '') => request(`/search/messages?q=${encodeURIComponent(query)}${cursor ? `&cursor=${cursor}` : ''}`),
+    searchUsers: (query) => request(`/users/search?q=${encodeURIComponent(query)}`),
+    blockUser: (username) => request('/blocks', {
+        method: 'POST',
+        body: JSON.stringify({ username }),
+    }),
+    unblockUser: (userId) => request(`/blocks/${userId}`, { method: 'DELETE' }),
     getGroups: () => {
         // This endpoint doesn't exist, so we'll mock it for now.
         // In a real app, you'd fetch groups the user is a member of.
@@ -9,6 +9,39 @@ const messageForm = document.getElementById('message-form');
 const logoutBtn = document.getElementById('logout-btn');
 const loginTabBtn = document.getElementById('login-tab-btn');
 const registerTabBtn = document.getElementById('register-tab-btn');
+const forgotPasswordBtn = document.getElementById('forgot-password-btn');
+
+// Access tokens are refreshed this long before they expire, so the server
+// never closes the WebSocket for an expired token.
+const TOKEN_REFRESH_MARGIN_MS = 60 * 1000;
+let refreshTimer = null;
+
+// Reads the claims of a JWT, whose segments are base64url encoded.
+function decodeTokenPayload(token) {
+    const segment = token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/');
+    return JSON.parse(atob(segment));
+}
+
+function scheduleTokenRefresh(accessToken) {
+    clearTimeout(refreshTimer);
+    const { exp } = decodeTokenPayload(accessToken);
+    const delay = Math.max(exp * 1000 - Date.now() - TOKEN_REFRESH_MARGIN_MS, 0);
+    refreshTimer = setTimeout(refreshTokens, delay);
+}
+
+async function refreshTokens() {
+    try {
+        const { refreshToken } = getState();
+        // refreshToken is absent when the server keeps it in an HttpOnly cookie.
+        const { accessToken, refreshToken: nextRefreshToken = null } = await api.refresh(refreshToken);
+        setState({ accessToken, refreshToken: nextRefreshToken });
+        ws.reauthenticate(accessToken);
+        scheduleTokenRefresh(accessToken);
+    } catch (error) {
+        console.error('Token refresh failed:', error);
+        await handleLogout();
+    }
+}
 
 async function handleLogin(e) {
     e.preventDefault();
@@ -18,7 +51,16 @@ async function handleLogin(e) {
         const formData = new FormData(e.target);
         console.log("Login:", formData)
         const { username, password } = Object.fromEntries(formData.entries());
-        const { accessToken, refreshToken } = await api.login(username, password);
+        let tokens = await api.login(username, password);
+        if (tokens.twoFactorRequired) {
+            const code = window.prompt('Enter the code from your authenticator app or a recovery code');
+            if (!code) {
+                return;
+            }
+            tokens = await api.loginTwoFactor(tokens.challengeToken, code.trim());
+        }
+        // refreshToken is absent when the server keeps it in an HttpOnly cookie.
+        const { accessToken, refreshToken = null } = tokens;
         setState({ accessToken, refreshToken });
         await initializeApp();
     } catch (error) {
@@ -46,15 +88,57 @@ async function handleRegister(e) {
     }
 }
 
+async function handleForgotPassword() {
+    const email = window.prompt('Enter the email address of your account');
+    if (!email) {
+        return;
+    }
+    try {
+        const { message } = await api.forgotPassword(email.trim());
+        alert(message);
+    } catch (error) {
+        ui.showAuthError(error.message);
+    }
+}
+
+// Handles the links sent by email, which open the app with a token.
+async function handleEmailLink() {
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!token) {
+        return;
+    }
+    try {
+        if (window.location.pathname === '/verify-email') {
+            await api.verifyEmail(token);
+            alert('Your email address has been verified.');
+        } else if (window.location.pathname === '/reset-password') {
+            const newPassword = window.prompt('Choose a new password (min 8 chars)');
+            if (!newPassword) {
+                return;
+            }
+            await api.resetPassword(token, newPassword);
+            alert('Your password has been reset. Please log in.');
+        }
+    } catch (error) {
+        ui.showAuthError(error.message);
+    } finally {
+        window.history.replaceState(null, '', '/');
+    }
+}
+
 async function handleLogout() {
     try {
         const { refreshToken } = getState();
         if (refreshToken) {
             await api.logout(refreshToken);
+        } else {
+            await api.logoutWithCookie();
         }
     } catch (error) {
         console.error('Logout failed:', error);
     } finally {
+        clearTimeout(refreshTimer);
+        refreshTimer = null;
         ws.disconnect();
         setState({
             currentUser: null,
@@ -100,6 +184,14 @@ function setupWsListeners() {
         console.log('Message acknowledged:', payload.messageId);
         // Can be used to update message status to "sent"
     });
+
+    ws.onEvent('error', (payload) => {
+        if (payload.code === 'rate_limited' || payload.code === 'slow_mode' || payload.code === 'not_group_member') {
+            alert(payload.message);
+        } else {
+            console.warn('WebSocket error frame:', payload);
+        }
+    });
 }
 
 async function initializeApp() {
@@ -108,12 +200,13 @@ async function initializeApp() {
 
     try {
         // Mock current user from token until we have a /me endpoint
-        const tokenPayload = JSON.parse(atob(accessToken.split('.')[1]));
+        const tokenPayload = decodeTokenPayload(accessToken);
         const currentUser = { id: tokenPayload.user_id, username: 'You' }; // Username is a placeholder
         setState({ currentUser });
 
         ui.renderUserProfile(currentUser);
 
+        scheduleTokenRefresh(accessToken);
         ws.connect(accessToken);
         setupWsListeners();
 
@@ -137,8 +230,10 @@ messageForm.addEventListener('submit', handleSendMessage);
 logoutBtn.addEventListener('click', handleLogout);
 loginTabBtn.addEventListener('click', () => ui.switchAuthTab('login'));
 registerTabBtn.addEventListener('click', () => ui.switchAuthTab('register'));
+forgotPasswordBtn.addEventListener('click', handleForgotPassword);
 
 // Initial check (e.g., for a stored refresh token) could go here
 // For now, we start at the auth view.
 ui.showView('auth');
+handleEmailLink();
 
@@ -1,3 +1,15 @@
+/**
+ * Display names and statuses are free text, so they are escaped before being
+ * placed in markup.
+ * @param {string} text
+ */
+const escapeHtml = (text) => text.replace(/[&<>"']/g, (c) => ({
+    '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;',
+})[c]);
+
+/** @param {import('./types.js').User} user */
+const displayName = (user) => escapeHtml(user.displayName || user.username);
+
 /**
  * @param {import('./types.js').User} user
  */
@@ -5,8 +17,8 @@ export const userProfileTemplate = (user) => `
     <div class="flex items-center space-x-4">
         <img src="${user.profilePicUrl || 'https://placehold.co/40'}" alt="Profile" class="w-10 h-10 rounded-full">
         <div>
-            <h3 class="font-bold">${user.username}</h3>
-            <p class="text-sm text-text-dim">Online</p>
+            <h3 class="font-bold">${displayName(user)}</h3>
+            <p class="text-sm text-text-dim">${user.status ? escapeHtml(`${user.status.emoji} ${user.status.text}`.trim()) : 'Online'}</p>
         </div>
     </div>
 `;
@@ -20,7 +32,7 @@ export const friendListTemplate = (friends) => `
         ${friends.map(friend => `
             <li data-id="${friend.id}" data-username="${friend.username}" class="flex items-center p-2 space-x-3 rounded-md cursor-pointer hover:bg-accent">
                 <img src="${friend.profilePicUrl || 'https://via.placeholder.com/32'}" alt="${friend.username}" class="w-8 h-8 rounded-full">
-                <span>${friend.username}</span>
+                <span>${displayName(friend)}</span>
             </li>
         `).join('')}
     </ul>
@@ -2,6 +2,10 @@
  * @typedef {object} User
  * @property {string} id
  * @property {string} username
+ * @property {string} displayName
+ * @property {string} bio
+ * @property {{text: string, emoji: string, expiresAt?: string}} [status]
+ * @property {string} [lastSeenAt]
  * @property {string} profilePicUrl
  */
 
@@ -1,9 +1,21 @@
+import { api } from './api.js';
+
 let socket = null;
+let lastToken = null;
+// Delay requested by the server in its "server_restarting" frame.
+let reconnectAfterMs = null;
 const eventListeners = new Map();
 
+// Close code sent by the server when it shuts down (1012 Service Restart).
+const CLOSE_SERVICE_RESTART = 1012;
+const DEFAULT_RECONNECT_MS = 3000;
+
 const handleMessage = (event) => {
     try {
         const data = JSON.parse(event.data);
+        if (data.type === 'server_restarting') {
+            reconnectAfterMs = data.payload.reconnectAfterMs;
+        }
         if (data.type && eventListeners.has(data.type)) {
             eventListeners.get(data.type).forEach(callback => callback(data.payload));
         } else {
@@ -15,27 +27,46 @@ const handleMessage = (event) => {
 };
 
 export const ws = {
-    connect: (token) => {
+    connect: async (token) => {
         if (socket && socket.readyState === WebSocket.OPEN) {
             console.log('WebSocket is already connected.');
             return;
         }
+        lastToken = token;
+        reconnectAfterMs = null;
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const url = `${protocol}//${window.location.host}/api/v1/ws`;
-        
+        let url = `${protocol}//${window.location.host}/ws`;
+
+        // Browsers cannot send an Authorization header on the upgrade, so we
+        // exchange the access token for a single-use ticket. If that fails we
+        // fall back to authenticating with the first frame.
+        let ticket = null;
+        try {
+            ({ ticket } = await api.getWsTicket());
+            url += `?ticket=${encodeURIComponent(ticket)}`;
+        } catch (error) {
+            console.warn('Could not get WebSocket ticket, using auth frame:', error);
+        }
+
         socket = new WebSocket(url);
 
         socket.onopen = () => {
             console.log('WebSocket connected.');
-            // Send auth token immediately after connection
-            socket.send(JSON.stringify({ type: 'auth', payload: { token } }));
+            if (!ticket) {
+                socket.send(JSON.stringify({ type: 'auth', payload: { token } }));
+            }
         };
 
         socket.onmessage = handleMessage;
 
-        socket.onclose = () => {
-            console.log('WebSocket disconnected.');
+        socket.onclose = (event) => {
+            console.log('WebSocket disconnected.', event.code, event.reason);
             socket = null;
+            // The server is restarting; another instance will take us after
+            // the delay it asked for.
+            if (event.code === CLOSE_SERVICE_RESTART && lastToken) {
+                setTimeout(() => ws.connect(lastToken), reconnectAfterMs ?? DEFAULT_RECONNECT_MS);
+            }
         };
 
         socket.onerror = (error) => {
@@ -44,11 +75,21 @@ export const ws = {
     },
 
     disconnect: () => {
+        lastToken = null;
         if (socket) {
             socket.close();
         }
     },
 
+    // Re-authenticates an open connection with a fresh access token so the
+    // server does not close it when the previous token expires.
+    reauthenticate: (token) => {
+        lastToken = token;
+        if (socket && socket.readyState === WebSocket.OPEN) {
+            socket.send(JSON.stringify({ type: 'auth', payload: { token } }));
+        }
+    },
+
     sendMessage: (message) => {
         if (socket && socket.readyState === WebSocket.OPEN) {
             socket.send(JSON.stringify(message));